@@ -0,0 +1,370 @@
+// Package cli table-sync 命令行工具, 在应用进程外查看或执行结构同步
+//
+// Go 无法在运行时加载结构体, 需在自己的 main 包中注册表后调用 Main:
+//
+//	func main() {
+//		tablesync.Register(User{}, Post{})
+//		cli.Main()
+//	}
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/glennliao/table-sync/model"
+	"github.com/glennliao/table-sync/tablesync"
+	_ "github.com/gogf/gf/contrib/drivers/mysql/v2"
+	_ "github.com/gogf/gf/contrib/drivers/pgsql/v2"
+	_ "github.com/gogf/gf/contrib/drivers/sqlite/v2"
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/errors/gerror"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gcfg"
+	"github.com/gogf/gf/v2/os/gfile"
+)
+
+const usage = `Usage: table-sync <command> [flags]
+
+Commands:
+  plan    print the sql needed to sync registered tables to the database
+  apply   execute the sync
+  diff    print structural differences between registered tables and the database
+  dump    print the database (or registered tables) schema snapshot as json/yaml
+  check   exit with status 1 when the database differs from registered tables
+  gen     generate go structs with ddl tags from the database schema
+
+Flags:
+  -config string   gf config file (default: gf config search path, config.toml)
+  -group string    database group in config, only tables of this group are synced (default "default")
+
+Run 'table-sync <command> -h' for command flags.
+`
+
+// ErrDrift check 命令发现数据库结构与代码不一致
+var ErrDrift = gerror.New("database schema differs from registered tables")
+
+// Out 命令输出
+var Out io.Writer = os.Stdout
+
+// Main 执行命令行参数对应的命令, 出错时退出码为1
+func Main() {
+	if err := Run(context.Background(), os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+type command struct {
+	flags *flag.FlagSet
+
+	config string
+	group  string
+
+	schemaFiles      string
+	allowDropColumn  bool
+	allowDropIndex   bool
+	allowDestructive bool
+	preflight        bool
+	concurrentIndex  bool
+	defaultSchema    string
+	pgSchemas        string
+	lockTimeout      time.Duration
+	recordHistory    bool
+	appVersion       string
+
+	packageName string
+	output      string
+
+	format string
+	code   bool
+}
+
+// Run 执行命令, args 不包含程序名
+func Run(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "help" {
+		fmt.Fprint(Out, usage)
+		return nil
+	}
+
+	name := args[0]
+	cmd := &command{flags: flag.NewFlagSet(name, flag.ContinueOnError)}
+	cmd.flags.SetOutput(Out)
+	cmd.flags.StringVar(&cmd.config, "config", "", "gf config file")
+	cmd.flags.StringVar(&cmd.group, "group", gdb.DefaultGroupName, "database group in config, only tables of this group are synced")
+
+	var run func(ctx context.Context, db gdb.DB) error
+	switch name {
+	case "plan":
+		cmd.syncerFlags()
+		run = cmd.plan
+	case "apply":
+		cmd.syncerFlags()
+		cmd.flags.DurationVar(&cmd.lockTimeout, "lock-timeout", 0, "acquire a cross-instance lock before syncing")
+		cmd.flags.BoolVar(&cmd.recordHistory, "history", false, "record the sync into tablesync_history")
+		cmd.flags.StringVar(&cmd.appVersion, "app-version", "", "application version recorded in history")
+		cmd.flags.BoolVar(&cmd.allowDestructive, "allow-destructive", false, "apply changes that may lose data, e.g. narrowing a column")
+		cmd.flags.BoolVar(&cmd.preflight, "preflight", false, "check existing data before applying risky changes")
+		run = cmd.apply
+	case "diff":
+		cmd.syncerFlags()
+		run = cmd.diff
+	case "dump":
+		cmd.flags.StringVar(&cmd.schemaFiles, "schema", "", "comma separated yaml/json schema files, dumped with -code")
+		cmd.flags.StringVar(&cmd.format, "format", "json", "snapshot format json/yaml")
+		cmd.flags.BoolVar(&cmd.code, "code", false, "dump registered tables instead of the database")
+		cmd.flags.StringVar(&cmd.output, "o", "", "output file (default stdout)")
+		cmd.flags.StringVar(&cmd.pgSchemas, "pg-schemas", "", "comma separated pgsql schemas to read (default public)")
+		run = cmd.dump
+	case "check":
+		cmd.syncerFlags()
+		run = cmd.check
+	case "gen":
+		cmd.flags.StringVar(&cmd.packageName, "package", "model", "package name of generated file")
+		cmd.flags.StringVar(&cmd.output, "o", "", "output file (default stdout)")
+		cmd.flags.StringVar(&cmd.pgSchemas, "pg-schemas", "", "comma separated pgsql schemas to read (default public)")
+		run = cmd.gen
+	default:
+		fmt.Fprint(Out, usage)
+		return gerror.Newf("unknown command: %s", name)
+	}
+
+	if err := cmd.flags.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+
+	db, err := cmd.db()
+	if err != nil {
+		return err
+	}
+	return run(ctx, db)
+}
+
+func (c *command) syncerFlags() {
+	c.flags.StringVar(&c.schemaFiles, "schema", "", "comma separated yaml/json schema files, synced with registered tables")
+	c.flags.BoolVar(&c.allowDropColumn, "drop-column", false, "drop columns no longer in registered tables")
+	c.flags.BoolVar(&c.allowDropIndex, "drop-index", false, "drop indexes no longer in registered tables")
+	c.flags.BoolVar(&c.concurrentIndex, "concurrent-index", false, "pgsql: create new indexes concurrently outside the transaction")
+	c.flags.StringVar(&c.defaultSchema, "default-schema", "", "pgsql: schema of tables without schema tag (default public)")
+}
+
+// db g.DB 按配置文件中的 database 配置创建连接, 配置错误时 panic, 转为错误返回
+func (c *command) db() (db gdb.DB, err error) {
+	if c.config != "" {
+		adapter, err := gcfg.NewAdapterFile(c.config)
+		if err != nil {
+			return nil, err
+		}
+		g.Cfg().SetAdapter(adapter)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = gerror.Newf("database group %s: %v", c.group, r)
+		}
+	}()
+	return g.DB(c.group), nil
+}
+
+// splitList 逗号分隔的参数, 忽略空项
+func splitList(s string) (list []string) {
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return
+}
+
+func (c *command) syncer() (*tablesync.Syncer, error) {
+	tables := tablesync.Registered()
+	schemaFiles := splitList(c.schemaFiles)
+	if len(tables) == 0 && len(schemaFiles) == 0 {
+		return nil, gerror.New("no table registered, call tablesync.Register before cli.Main or use -schema")
+	}
+	return &tablesync.Syncer{
+		Tables:           tables,
+		SchemaFiles:      schemaFiles,
+		AllowDropColumn:  c.allowDropColumn,
+		AllowDropIndex:   c.allowDropIndex,
+		AllowDestructive: c.allowDestructive,
+		Preflight:        c.preflight,
+		ConcurrentIndex:  c.concurrentIndex,
+		DefaultSchema:    c.defaultSchema,
+		LockTimeout:      c.lockTimeout,
+		RecordHistory:    c.recordHistory,
+		AppVersion:       c.appVersion,
+		Group:            c.group,
+	}, nil
+}
+
+func (c *command) loadPlan(ctx context.Context, db gdb.DB) (*tablesync.Plan, error) {
+	syncer, err := c.syncer()
+	if err != nil {
+		return nil, err
+	}
+	return syncer.Plan(ctx, db)
+}
+
+func (c *command) plan(ctx context.Context, db gdb.DB) error {
+	plan, err := c.loadPlan(ctx, db)
+	if err != nil {
+		return err
+	}
+	if plan.Empty() {
+		fmt.Fprintln(Out, "-- database is up to date")
+		return nil
+	}
+	fmt.Fprint(Out, plan)
+	return nil
+}
+
+func (c *command) apply(ctx context.Context, db gdb.DB) error {
+	syncer, err := c.syncer()
+	if err != nil {
+		return err
+	}
+	return syncer.Sync(ctx, db)
+}
+
+func (c *command) diff(ctx context.Context, db gdb.DB) error {
+	plan, err := c.loadPlan(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(Out, formatDiff(plan.Task))
+	return nil
+}
+
+func (c *command) check(ctx context.Context, db gdb.DB) error {
+	plan, err := c.loadPlan(ctx, db)
+	if err != nil {
+		return err
+	}
+	if plan.Empty() {
+		fmt.Fprintln(Out, "database is up to date")
+		return nil
+	}
+	fmt.Fprint(Out, formatDiff(plan.Task))
+	return ErrDrift
+}
+
+func (c *command) dump(ctx context.Context, db gdb.DB) error {
+	var snapshot model.Snapshot
+	if c.code {
+		syncer, err := c.syncer()
+		if err != nil {
+			return err
+		}
+		if snapshot, err = syncer.CodeSnapshot(db.GetConfig().Type); err != nil {
+			return err
+		}
+	} else {
+		schema, err := tablesync.LoadSchema(ctx, db, splitList(c.pgSchemas)...)
+		if err != nil {
+			return err
+		}
+		snapshot = model.NewSnapshot(schema, db.GetConfig().Type)
+	}
+
+	var data []byte
+	var err error
+	switch c.format {
+	case "json":
+		data, err = snapshot.JSON()
+	case "yaml":
+		data, err = snapshot.YAML()
+	default:
+		err = gerror.Newf("unsupported format: %s", c.format)
+	}
+	if err != nil {
+		return err
+	}
+	if c.output != "" {
+		return gfile.PutBytes(c.output, data)
+	}
+	_, err = Out.Write(data)
+	return err
+}
+
+func (c *command) gen(ctx context.Context, db gdb.DB) error {
+	src, err := tablesync.GenerateFromDB(ctx, db, c.packageName, splitList(c.pgSchemas)...)
+	if err != nil {
+		return err
+	}
+	if c.output != "" {
+		return gfile.PutBytes(c.output, src)
+	}
+	_, err = Out.Write(src)
+	return err
+}
+
+// formatDiff 按 +新增 -删除 ~修改 >重命名 输出结构差异
+func formatDiff(task model.SyncTask) string {
+	var b strings.Builder
+	line := func(op string, format string, args ...any) {
+		b.WriteString(op + " " + fmt.Sprintf(format, args...) + "\n")
+	}
+
+	for _, rename := range task.RenameTable {
+		line(">", "table %s -> %s", rename.From, rename.To)
+	}
+	for _, table := range task.CreateTable {
+		line("+", "table %s", table.Name)
+	}
+	for _, alter := range task.AlterTable {
+		var changes []string
+		if alter.Comment {
+			changes = append(changes, "comment")
+		}
+		if alter.Charset {
+			changes = append(changes, "charset")
+		}
+		if alter.PrimaryKey {
+			changes = append(changes, "primary key ("+strings.Join(alter.Table.PrimaryKey, ",")+")")
+		}
+		line("~", "table %s: %s", alter.Table.Name, strings.Join(changes, ", "))
+	}
+	for _, rename := range task.RenameColumn {
+		line(">", "column %s.%s -> %s", rename.TableName, rename.From, rename.Column.Field)
+	}
+	for _, column := range task.AddColumn {
+		line("+", "column %s.%s %s %s", column.TableName, column.Field, column.Type, column.NotNull)
+	}
+	for _, column := range task.AlterColumn {
+		from := ""
+		if dbColumn, exists := task.DBColumn(column.TableName, task.DBColumnName(column.TableName, column.Field)); exists {
+			from = dbColumn.Type + " " + dbColumn.NotNull + " -> "
+		}
+		line("~", "column %s.%s %s%s %s", column.TableName, column.Field, from, column.Type, column.NotNull)
+	}
+	for _, column := range task.DropColumn {
+		line("-", "column %s.%s", column.TableName, column.Field)
+	}
+	for _, index := range task.DropIndex {
+		line("-", "index %s.%s (%s)", index.TableName, index.Name, strings.Join(index.Columns, ","))
+	}
+	for _, index := range task.AddIndex {
+		line("+", "index %s.%s (%s)", index.TableName, index.Name, strings.Join(index.Columns, ","))
+	}
+	for _, fk := range task.DropForeignKey {
+		line("-", "foreign key %s.%s", fk.TableName, fk.Name)
+	}
+	for _, fk := range task.AddForeignKey {
+		line("+", "foreign key %s.%s (%s) -> %s (%s)", fk.TableName, fk.Name, strings.Join(fk.Columns, ","), fk.RefTable, strings.Join(fk.RefColumns, ","))
+	}
+	for _, check := range task.DropCheck {
+		line("-", "check %s.%s", check.TableName, check.Name)
+	}
+	for _, check := range task.AddCheck {
+		line("+", "check %s.%s %s", check.TableName, check.Name, check.Expr)
+	}
+	return b.String()
+}
@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gogf/gf/v2/os/gfile"
+)
+
+const userSchema = `tables:
+  - name: user
+    comment: 用户
+    columns:
+      - name: id
+        type: int64
+        ddl: primaryKey
+      - name: name
+        type: string
+        ddl: size:64;not null;uniqueIndex
+`
+
+func run(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	stdout := Out
+	Out = &out
+	err := Run(context.Background(), args)
+	Out = stdout
+	return out.String(), err
+}
+
+// check 发现差异时返回 ErrDrift, apply 后一致; dump/gen 读取同步后的数据库
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	config, schema := filepath.Join(dir, "config.toml"), filepath.Join(dir, "user.yaml")
+	if err := gfile.PutContents(config, fmt.Sprintf("[database.default]\nlink = \"sqlite::@file(%s)\"\n", filepath.Join(dir, "test.db"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := gfile.PutContents(schema, userSchema); err != nil {
+		t.Fatal(err)
+	}
+	flags := []string{"-config", config, "-schema", schema}
+
+	out, err := run(t, append([]string{"check"}, flags...)...)
+	if err != ErrDrift || !strings.Contains(out, "+ table user") {
+		t.Errorf("check before apply: %v\n%s", err, out)
+	}
+	if out, err = run(t, append([]string{"plan"}, flags...)...); err != nil || !strings.Contains(out, "CREATE TABLE `user`") {
+		t.Errorf("plan: %v\n%s", err, out)
+	}
+
+	if _, err = run(t, append([]string{"apply"}, flags...)...); err != nil {
+		t.Fatal(err)
+	}
+	if out, err = run(t, append([]string{"check"}, flags...)...); err != nil || !strings.Contains(out, "up to date") {
+		t.Errorf("check after apply: %v\n%s", err, out)
+	}
+	if out, err = run(t, append([]string{"diff"}, flags...)...); err != nil || out != "" {
+		t.Errorf("diff after apply: %v\n%s", err, out)
+	}
+
+	if out, err = run(t, "dump", "-config", config, "-format", "yaml"); err != nil || !strings.Contains(out, "name: user") {
+		t.Errorf("dump: %v\n%s", err, out)
+	}
+	if out, err = run(t, "gen", "-config", config, "-package", "entity"); err != nil || !strings.Contains(out, "package entity") || !strings.Contains(out, "type User struct") {
+		t.Errorf("gen: %v\n%s", err, out)
+	}
+
+	if _, err = run(t, "migrate"); err == nil {
+		t.Error("unknown command should fail")
+	}
+	if _, err = run(t, "plan", "-config", config); err == nil {
+		t.Error("plan without tables should fail")
+	}
+}
+
+const groupSchema = `tables:
+  - name: user
+    columns:
+      - name: id
+        type: int64
+        ddl: primaryKey
+  - name: access_log
+    group: log
+    columns:
+      - name: id
+        type: int64
+        ddl: primaryKey
+  - name: audit
+    group: audit
+    columns:
+      - name: id
+        type: int64
+        ddl: primaryKey
+`
+
+// -group 同时选择连接及同步的表, 其他分组的表不会同步到该分组的数据库
+func TestRunGroup(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	config, schema := filepath.Join(dir, "config.toml"), filepath.Join(dir, "schema.yaml")
+	content := fmt.Sprintf("[database.log]\nlink = \"sqlite::@file(%s)\"\n[database.audit]\nlink = \"sqlite::@file(%s)\"\n",
+		filepath.Join(dir, "log.db"), filepath.Join(dir, "audit.db"))
+	if err := gfile.PutContents(config, content); err != nil {
+		t.Fatal(err)
+	}
+	if err := gfile.PutContents(schema, groupSchema); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"log": "access_log", "audit": "audit"}
+	for group, table := range want {
+		out, err := run(t, "plan", "-config", config, "-schema", schema, "-group", group)
+		if err != nil || !strings.Contains(out, "CREATE TABLE `"+table+"`") || strings.Contains(out, "`user`") {
+			t.Errorf("plan -group %s: %v\n%s", group, err, out)
+		}
+		if _, err = run(t, "apply", "-config", config, "-schema", schema, "-group", group); err != nil {
+			t.Fatal(err)
+		}
+		if out, err = run(t, "check", "-config", config, "-schema", schema, "-group", group); err != nil {
+			t.Errorf("check -group %s: %v\n%s", group, err, out)
+		}
+
+		db, err := (&command{config: config, group: group}).db()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tables, err := db.Tables(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range tables {
+			if name != table && name != "sqlite_sequence" {
+				t.Errorf("group %s should only contain %s, got %v", group, table, tables)
+			}
+		}
+	}
+}
@@ -0,0 +1,9 @@
+// table-sync 命令行工具, 未注册任何表, 可用于 dump;
+// plan/apply/diff/check 需在自己的 main 包中 tablesync.Register 后调用 cli.Main
+package main
+
+import "github.com/glennliao/table-sync/cli"
+
+func main() {
+	cli.Main()
+}
@@ -2,14 +2,34 @@ package database
 
 import (
 	"context"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/glennliao/table-sync/model"
 	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/errors/gerror"
 )
 
 type Database interface {
 	LoadSchema(ctx context.Context, db gdb.DB) (model.Schema, error)
 	GetSqlType(ctx context.Context, goType string, size string) string
-	GetSyncSql(ctx context.Context, db gdb.DB, task model.SyncTask) ([]string, error)
+	// GetGoType GetSqlType 的反向映射, 用于从数据库结构生成结构体, 无法映射时返回 string
+	GetGoType(ctx context.Context, sqlType string) (goType string, size string)
+	GetSyncSql(ctx context.Context, db gdb.DB, task model.SyncTask) ([]model.SyncSql, error)
+	// Lock 获取跨实例的同步锁, 超时未获取返回错误, 成功后需调用 unlock 释放
+	Lock(ctx context.Context, db gdb.DB, name string, timeout time.Duration) (unlock func(ctx context.Context) error, err error)
+}
+
+// TxExecutor 需要在固定连接上执行同步事务的驱动实现, 未实现时在 gf 事务中依次执行
+type TxExecutor interface {
+	ExecTx(ctx context.Context, db gdb.DB, sqlList []string) error
+}
+
+// SchemaLoader 表可分布在多个 schema 中的驱动(pgsql)实现, 仅加载指定 schema 中的表,
+// LoadSchema 只加载默认 schema
+type SchemaLoader interface {
+	LoadSchemas(ctx context.Context, db gdb.DB, schemas []string) (model.Schema, error)
 }
 
 var RegMap = map[string]Database{}
@@ -17,3 +37,56 @@ var RegMap = map[string]Database{}
 func RegDatabase(name string, database Database) {
 	RegMap[name] = database
 }
+
+const lockRetryInterval = 500 * time.Millisecond
+
+// WaitLock 轮询 tryLock 直到获取锁或超时, 用于不支持阻塞等待的锁
+func WaitLock(ctx context.Context, name string, timeout time.Duration, tryLock func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := tryLock()
+		if err != nil || ok {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return gerror.Newf("acquire lock %s timeout after %s", name, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// Charset 用于比较的字符集, 未声明时取排序规则的前缀(utf8mb4_general_ci => utf8mb4)
+func Charset(charset string, collation string) string {
+	if charset == "" {
+		charset, _, _ = strings.Cut(collation, "_")
+	}
+	return NormalizeCharset(charset)
+}
+
+// NormalizeCharset 统一字符集/排序规则的大小写, utf8 为 utf8mb3 的别名(utf8_general_ci => utf8mb3_general_ci)
+func NormalizeCharset(s string) string {
+	s = strings.ToLower(s)
+	if s == "utf8" || strings.HasPrefix(s, "utf8_") {
+		return "utf8mb3" + s[len("utf8"):]
+	}
+	return s
+}
+
+// SplitSqlType 拆分 varchar(256) 为 varchar 和 256, 类型参数不是单个数字时 size 为空
+func SplitSqlType(sqlType string) (name string, size string) {
+	name = strings.TrimSpace(sqlType)
+	if i := strings.Index(name, "("); i > 0 {
+		if j := strings.Index(name[i:], ")"); j > 0 {
+			size = name[i+1 : i+j]
+			name = name[:i] + name[i+j+1:]
+		}
+	}
+	if _, err := strconv.Atoi(size); err != nil {
+		size = ""
+	}
+	return strings.ToLower(strings.TrimSpace(name)), size
+}
@@ -2,12 +2,16 @@ package mysql
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"math"
 	"strings"
+	"time"
 
 	"github.com/glennliao/table-sync/database"
 	"github.com/glennliao/table-sync/model"
 	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/errors/gerror"
 )
 
 func init() {
@@ -37,6 +41,14 @@ func (d *Mysql) LoadSchema(ctx context.Context, db gdb.DB) (schema model.Schema,
 	if err != nil {
 		return
 	}
+	foreignKeys, err := d.loadForeignKey(ctx, db, schemaName)
+	if err != nil {
+		return
+	}
+	checks, err := d.loadCheck(ctx, db, schemaName)
+	if err != nil {
+		return
+	}
 
 	var tableMap = map[string]*model.Table{}
 	for i, table := range tables {
@@ -51,10 +63,22 @@ func (d *Mysql) LoadSchema(ctx context.Context, db gdb.DB) (schema model.Schema,
 	for _, index := range indexs {
 
 		if index.Name == "PRIMARY" {
+			table := tableMap[index.TableName]
+			table.PrimaryKey = index.Columns
+			for i, column := range table.Columns {
+				table.Columns[i].PrimaryKey = inList(index.Columns, column.Field)
+			}
 			continue
 		}
 		tableMap[index.TableName].Index = append(tableMap[index.TableName].Index, index)
 	}
+	for _, fk := range foreignKeys {
+		tableMap[fk.TableName].ForeignKeys = append(tableMap[fk.TableName].ForeignKeys, fk)
+	}
+
+	for _, check := range checks {
+		tableMap[check.TableName].Checks = append(tableMap[check.TableName].Checks, check)
+	}
 	schema.Tables = tableMap
 
 	return
@@ -94,29 +118,166 @@ func (d *Mysql) GetSqlType(ctx context.Context, goType string, size string) stri
 	return goType
 }
 
-func (d *Mysql) GetSyncSql(ctx context.Context, db gdb.DB, task model.SyncTask) (list []string, err error) {
+var goTypeMap = map[string]string{
+	"tinyint":           "int8",
+	"tinyint unsigned":  "uint8",
+	"smallint":          "int16",
+	"smallint unsigned": "uint16",
+	"mediumint":         "int32",
+	"int":               "int",
+	"int unsigned":      "uint32",
+	"bigint":            "int64",
+	"bigint unsigned":   "uint64",
+	"float":             "float32",
+	"double":            "float64",
+	"decimal":           "float64",
+	"datetime":          "time.Time",
+	"timestamp":         "time.Time",
+	"date":              "time.Time",
+	"blob":              "[]byte",
+	"longblob":          "[]byte",
+	"varbinary":         "[]byte",
+}
+
+func (d *Mysql) GetGoType(ctx context.Context, sqlType string) (string, string) {
+	name, size := database.SplitSqlType(sqlType)
+	if v, exists := goTypeMap[name]; exists {
+		if strings.HasSuffix(name, "int") || strings.HasSuffix(name, "int unsigned") {
+			size = ""
+		}
+		return v, size
+	}
+	if name == "varchar" {
+		return "string", size
+	}
+	return "string", ""
+}
+
+func (d *Mysql) GetSyncSql(ctx context.Context, db gdb.DB, task model.SyncTask) (list []model.SyncSql, err error) {
+
+	for _, rename := range task.RenameTable {
+		list = append(list, model.SyncSql{Table: rename.To, Kind: model.KindRenameTable, Sql: renameTable(rename),
+			Down: renameTable(model.TableRename{From: rename.To, To: rename.From})})
+	}
+
+	for _, fk := range task.DropForeignKey {
+		list = append(list, model.SyncSql{Table: fk.TableName, Kind: model.KindDropForeignKey, Name: fk.Name, Sql: dropForeignKey(fk), Down: addForeignKey(fk)})
+	}
+
+	for _, check := range task.DropCheck {
+		list = append(list, model.SyncSql{Table: check.TableName, Kind: model.KindDropCheck, Name: check.Name, Sql: dropCheck(check), Down: addCheck(check)})
+	}
 
 	for _, table := range task.CreateTable {
-		list = append(list, createTable(table)...)
+		list = append(list, model.SyncSql{Table: table.Name, Kind: model.KindCreateTable, Sql: createTable(table), Down: dropTable(table.Name)})
+	}
+
+	for _, alter := range task.AlterTable {
+		alter.Table = markAutoIncrement(alter.Table)
+		dbTable := task.DBTable(alter.Table.Name)
+		item := model.SyncSql{Table: alter.Table.Name, Kind: model.KindAlterTable, Sql: alterTable(alter, dbTable)}
+		if dbTable != nil {
+			// 还原为数据库中原有的表属性, 此时表已是新名称
+			downAlter := alter
+			downAlter.Table = *dbTable
+			downAlter.Table.Name = alter.Table.Name
+			downAlter.Table.Comment = escapeQuote(dbTable.Comment)
+			downAlter.Table.Columns = nil
+			for _, column := range dbTable.Columns {
+				downAlter.Table.Columns = append(downAlter.Table.Columns, codeColumnOf(column))
+			}
+			item.Down = alterTable(downAlter, &alter.Table)
+		}
+		list = append(list, item)
+	}
+
+	// CHANGE 同时修改列定义, 重命名的列无需再 MODIFY
+	var renamed = map[string]struct{}{}
+	for _, rename := range task.RenameColumn {
+		renamed[rename.TableName+"."+rename.Column.Field] = struct{}{}
+		item := model.SyncSql{Table: rename.TableName, Kind: model.KindRenameColumn, Name: rename.Column.Field, Sql: renameColumn(rename.TableName, rename.From, markColumn(task, rename.Column))}
+		if dbCol, exists := task.DBColumn(rename.TableName, rename.From); exists {
+			item.Down = renameColumn(rename.TableName, rename.Column.Field, codeColumnOf(dbCol))
+		}
+		list = append(list, item)
 	}
 
 	for _, col := range task.AddColumn {
-		list = append(list, addColumn(col.TableName, col)...)
+		list = append(list, model.SyncSql{Table: col.TableName, Kind: model.KindAddColumn, Name: col.Field, Sql: addColumn(col.TableName, markColumn(task, col)), Down: dropColumn(col.TableName, col)})
 	}
 
 	for _, col := range task.AlterColumn {
-		list = append(list, alterColumn(col.TableName, col)...)
+		if _, exists := renamed[col.TableName+"."+col.Field]; exists {
+			continue
+		}
+		item := model.SyncSql{Table: col.TableName, Kind: model.KindAlterColumn, Name: col.Field, Sql: alterColumn(col.TableName, markColumn(task, col))}
+		if dbCol, exists := task.DBColumn(col.TableName, col.Field); exists {
+			item.Down = alterColumn(col.TableName, codeColumnOf(dbCol))
+		}
+		list = append(list, item)
+	}
+
+	for _, index := range task.DropIndex {
+		list = append(list, model.SyncSql{Table: index.TableName, Kind: model.KindDropIndex, Name: index.Name, Sql: dropIndex(index.TableName, index), Down: addIndex(index.TableName, index)})
+	}
+
+	for _, col := range task.DropColumn {
+		list = append(list, model.SyncSql{Table: col.TableName, Kind: model.KindDropColumn, Name: col.Field, Sql: dropColumn(col.TableName, col), Down: addColumn(col.TableName, codeColumnOf(col))})
 	}
 
 	for _, index := range task.AddIndex {
-		list = append(list, addIndex(index.TableName, index)...)
+		list = append(list, model.SyncSql{Table: index.TableName, Kind: model.KindAddIndex, Name: index.Name, Sql: addIndex(index.TableName, index), Down: dropIndex(index.TableName, index)})
 	}
 
-	return
+	// 外键在所有表创建完成后添加, 避免引用的表尚未创建
+	var addForeignKeys []model.ForeignKey
+	for _, table := range task.CreateTable {
+		for _, fk := range table.ForeignKeys {
+			fk.TableName = table.Name
+			addForeignKeys = append(addForeignKeys, fk)
+		}
+	}
+	for _, fk := range append(addForeignKeys, task.AddForeignKey...) {
+		list = append(list, model.SyncSql{Table: fk.TableName, Kind: model.KindAddForeignKey, Name: fk.Name, Sql: addForeignKey(fk), Down: dropForeignKey(fk)})
+	}
+
+	for _, check := range task.AddCheck {
+		list = append(list, model.SyncSql{Table: check.TableName, Kind: model.KindAddCheck, Name: check.Name, Sql: addCheck(check), Down: dropCheck(check)})
+	}
+
+	return d.onlineDDL(ctx, db, task, list)
+}
+
+// Lock GET_LOCK 为会话级锁, 使用独立连接持有直到释放
+func (d *Mysql) Lock(ctx context.Context, db gdb.DB, name string, timeout time.Duration) (func(ctx context.Context) error, error) {
+	master, err := db.Master()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := master.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var locked sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, int(math.Ceil(timeout.Seconds()))).Scan(&locked)
+	if err == nil && locked.Int64 != 1 {
+		err = gerror.Newf("acquire lock %s timeout after %s", name, timeout)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return func(ctx context.Context) error {
+		defer conn.Close()
+		_, err := conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", name)
+		return err
+	}, nil
 }
 
 func (d *Mysql) loadTables(ctx context.Context, db gdb.DB, schemaName string) (list []model.Table, err error) {
-	sql := "SELECT table_name AS name,table_comment AS comment FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema = ? "
+	sql := "SELECT table_name AS name,table_comment AS comment,SUBSTRING_INDEX(table_collation,'_',1) AS charset,table_collation AS collation FROM information_schema.tables WHERE table_type = 'BASE TABLE' AND table_schema = ? "
 	err = db.GetScan(ctx, &list, sql, schemaName)
 	return
 }
@@ -157,16 +318,48 @@ func (d *Mysql) loadIndex(ctx context.Context, db gdb.DB, schemaName string) (li
 	return
 }
 
+func (d *Mysql) loadForeignKey(ctx context.Context, db gdb.DB, schemaName string) (list []model.ForeignKey, err error) {
+	sql := "SELECT k.constraint_name AS name,k.table_name AS tableName,GROUP_CONCAT(k.column_name ORDER BY k.ordinal_position) AS `columns`,k.referenced_table_name AS refTable,GROUP_CONCAT(k.referenced_column_name ORDER BY k.ordinal_position) AS refColumns,r.delete_rule AS onDelete,r.update_rule AS onUpdate FROM information_schema.key_column_usage k JOIN information_schema.referential_constraints r ON r.constraint_schema = k.constraint_schema AND r.constraint_name = k.constraint_name AND r.table_name = k.table_name WHERE k.table_schema = ? AND k.referenced_table_name IS NOT NULL GROUP BY k.constraint_name,k.table_name,k.referenced_table_name,r.delete_rule,r.update_rule "
+	err = db.GetScan(ctx, &list, sql, schemaName)
+	if err == nil {
+		for i := range list {
+			list[i].Columns = strings.Split(list[i].Columns[0], ",")
+			list[i].RefColumns = strings.Split(list[i].RefColumns[0], ",")
+		}
+	}
+	return
+}
+
+// loadCheck MySQL 8.0.16 之前没有 information_schema.check_constraints, 也不支持 CHECK 约束, 视为无约束
+func (d *Mysql) loadCheck(ctx context.Context, db gdb.DB, schemaName string) (list []model.Check, err error) {
+	supported, err := db.GetValue(ctx, "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = 'information_schema' AND table_name = 'CHECK_CONSTRAINTS'")
+	if err != nil {
+		return nil, gerror.Wrap(err, "load check constraints")
+	}
+	if supported.Int() == 0 {
+		return nil, nil
+	}
+
+	sql := "SELECT tc.constraint_name AS name,tc.table_name AS tableName,cc.check_clause AS expr FROM information_schema.table_constraints tc JOIN information_schema.check_constraints cc ON cc.constraint_schema = tc.constraint_schema AND cc.constraint_name = tc.constraint_name WHERE tc.table_schema = ? AND tc.constraint_type = 'CHECK' "
+	if err = db.GetScan(ctx, &list, sql, schemaName); err != nil {
+		return nil, gerror.Wrap(err, "load check constraints")
+	}
+	return
+}
+
 func createTable(table model.Table) []string {
 
 	var colSqlList []string
-	primaryKey := ""
+	primaryKey := table.PrimaryKey
 
 	for _, column := range table.Columns {
 
 		if column.PrimaryKey {
-			primaryKey = column.Field
-			colSqlList = append(colSqlList, fmt.Sprintf("\t`%s` %s NOT NULL AUTO_INCREMENT COMMENT '%s'", column.Field, column.Type, column.Comment))
+			opt := "NOT NULL"
+			if autoIncrement(table, column) {
+				opt += " AUTO_INCREMENT"
+			}
+			colSqlList = append(colSqlList, fmt.Sprintf("\t`%s` %s %s COMMENT '%s'", column.Field, column.Type, opt, column.Comment))
 		} else {
 			opt := ""
 
@@ -189,9 +382,8 @@ func createTable(table model.Table) []string {
 
 	var keys []string
 
-	if primaryKey != "" {
-		ext += ",\n"
-		keys = append(keys, fmt.Sprintf("PRIMARY KEY (`%s`)", primaryKey))
+	if len(primaryKey) > 0 {
+		keys = append(keys, fmt.Sprintf("PRIMARY KEY (%s)", quoteColumns(primaryKey)))
 	}
 
 	if len(table.Index) > 0 {
@@ -203,47 +395,184 @@ func createTable(table model.Table) []string {
 				indexSql += "index"
 			}
 			indexSql += " " + index.Name + " ("
-
-			for i, column := range index.Columns {
-				index.Columns[i] = "`" + column + "`"
-			}
-
-			indexSql += strings.Join(index.Columns, ",")
+			indexSql += quoteColumns(index.Columns)
 			indexSql += ") "
 			keys = append(keys, indexSql)
 		}
 	}
 
+	for _, check := range table.Checks {
+		keys = append(keys, fmt.Sprintf("CONSTRAINT `%s` CHECK (%s)", check.Name, check.Expr))
+	}
+
 	if len(keys) > 0 {
-		ext += strings.Join(keys, ",")
+		ext += ",\n" + strings.Join(keys, ",")
+	}
+
+	charset := tableCharset(table)
+	if table.Collation != "" {
+		charset += " COLLATE=" + table.Collation
 	}
 
-	createSql := fmt.Sprintf("CREATE TABLE `%s` (\n%s\n %s ) ENGINE=InnoDB DEFAULT CHARSET=%s COMMENT='%s'", table.Name, strings.Join(colSqlList, ",\n"), ext, table.Charset, table.Comment)
+	createSql := fmt.Sprintf("CREATE TABLE `%s` (\n%s\n %s ) ENGINE=InnoDB DEFAULT CHARSET=%s COMMENT='%s'", table.Name, strings.Join(colSqlList, ",\n"), ext, charset, table.Comment)
 
 	return []string{createSql}
 }
 
+func dropTable(tableName string) []string {
+	return []string{fmt.Sprintf("DROP TABLE `%s`", tableName)}
+}
+
+func renameTable(rename model.TableRename) []string {
+	return []string{fmt.Sprintf("RENAME TABLE `%s` TO `%s`", rename.From, rename.To)}
+}
+
+func alterTable(alter model.TableAlter, dbTable *model.Table) []string {
+	var sqlList []string
+	table := alter.Table
+
+	if alter.PrimaryKey {
+		// 自增列必须有索引, 删除主键前先去掉不再自增的列的 AUTO_INCREMENT, 添加主键后再给新的自增列加上
+		var ops, addAutoIncrement []string
+		for _, column := range table.Columns {
+			var current model.Column
+			if dbTable != nil {
+				current, _ = findColumn(*dbTable, column.Field)
+			}
+			switch was, is := isAutoIncrement(current), isAutoIncrement(column); {
+			case was && !is:
+				ops = append(ops, fmt.Sprintf("MODIFY COLUMN `%s` %s", column.Field, columnDefinition(column)))
+			case !was && is:
+				addAutoIncrement = append(addAutoIncrement, fmt.Sprintf("MODIFY COLUMN `%s` %s", column.Field, columnDefinition(column)))
+			}
+		}
+		if dbTable != nil && len(dbTable.PrimaryKey) > 0 {
+			ops = append(ops, "DROP PRIMARY KEY")
+		}
+		if len(table.PrimaryKey) > 0 {
+			ops = append(ops, fmt.Sprintf("ADD PRIMARY KEY (%s)", quoteColumns(table.PrimaryKey)))
+		}
+		ops = append(ops, addAutoIncrement...)
+		if len(ops) > 0 {
+			sqlList = append(sqlList, fmt.Sprintf("ALTER TABLE `%s` %s", table.Name, strings.Join(ops, ", ")))
+		}
+	}
+
+	if alter.Charset {
+		sql := fmt.Sprintf("ALTER TABLE `%s` CONVERT TO CHARACTER SET %s", table.Name, tableCharset(table))
+		if table.Collation != "" {
+			sql += " COLLATE " + table.Collation
+		}
+		sqlList = append(sqlList, sql)
+	}
+
+	if alter.Comment {
+		sqlList = append(sqlList, fmt.Sprintf("ALTER TABLE `%s` COMMENT='%s'", table.Name, table.Comment))
+	}
+
+	return sqlList
+}
+
+// tableCharset 未声明字符集时取排序规则对应的字符集, 均未声明时为 utf8mb4
+func tableCharset(table model.Table) string {
+	if table.Charset != "" {
+		return table.Charset
+	}
+	if charset, _, found := strings.Cut(table.Collation, "_"); found {
+		return charset
+	}
+	return "utf8mb4"
+}
+
 func addColumn(tableName string, col model.Column) []string {
 
-	addColumnSql := fmt.Sprintf("ALTER TABLE `%s` add `%s`  %s %s COMMENT '%s'", tableName, col.Field, col.Type, col.NotNull, col.Comment)
+	addColumnSql := fmt.Sprintf("ALTER TABLE `%s` add `%s` %s", tableName, col.Field, columnDefinition(col))
 	return []string{addColumnSql}
 }
 
 func alterColumn(tableName string, toCol model.Column) []string {
 
-	alterSql := ""
-	alterSql += " " + toCol.Type + " "
-	alterSql += " " + toCol.NotNull + " "
-	if toCol.Default != "" {
-		alterSql += " DEFAULT " + toCol.Default
+	alterSql := fmt.Sprintf("ALTER TABLE `%s` MODIFY COLUMN `%s` %s", tableName, toCol.Field, columnDefinition(toCol))
+	return []string{alterSql}
+
+}
+
+func renameColumn(tableName string, from string, toCol model.Column) []string {
+	renameSql := fmt.Sprintf("ALTER TABLE `%s` CHANGE `%s` `%s` %s", tableName, from, toCol.Field, columnDefinition(toCol))
+	return []string{renameSql}
+}
+
+func columnDefinition(col model.Column) string {
+	def := ""
+	def += " " + col.Type + " "
+	def += " " + col.NotNull + " "
+	if col.Default != "" {
+		def += " DEFAULT " + col.Default
 	}
-	if toCol.PrimaryKey && toCol.Field == "id" {
-		alterSql += " AUTO_INCREMENT "
+	if isAutoIncrement(col) {
+		def += " AUTO_INCREMENT "
 	}
-	alterSql += " comment '" + toCol.Comment + "' "
-	alterSql = fmt.Sprintf("ALTER TABLE `%s` MODIFY COLUMN `%s` %s", tableName, toCol.Field, alterSql)
-	return []string{alterSql}
+	def += " comment '" + col.Comment + "' "
+	return def
+}
+
+// autoIncrement 代码中的列是否自增: 只有单列整数主键自增, 联合主键及非整数主键不自增
+func autoIncrement(table model.Table, column model.Column) bool {
+	return column.PrimaryKey && len(table.PrimaryKey) == 1 && strings.Contains(column.Type, "int")
+}
+
+// isAutoIncrement 列的 EXTRA 含 auto_increment, 代码中的列由 markAutoIncrement/markColumn 标记
+func isAutoIncrement(column model.Column) bool {
+	return strings.Contains(strings.ToLower(column.EXTRA), "auto_increment")
+}
+
+// markAutoIncrement 按 autoIncrement 标记代码中表的自增列
+func markAutoIncrement(table model.Table) model.Table {
+	columns := make([]model.Column, len(table.Columns))
+	for i, column := range table.Columns {
+		if autoIncrement(table, column) {
+			column.EXTRA = "auto_increment"
+		}
+		columns[i] = column
+	}
+	table.Columns = columns
+	return table
+}
 
+// markColumn 按所在的代码表标记自增列
+func markColumn(task model.SyncTask, column model.Column) model.Column {
+	if table, exists := task.SchemaInCode.Tables[column.TableName]; exists && autoIncrement(*table, column) {
+		column.EXTRA = "auto_increment"
+	}
+	return column
+}
+
+// codeColumnOf 数据库中读取的列转为代码中的写法, 用于生成还原的SQL:
+// 字面量默认值加引号(information_schema 中不含引号), 注释中的单引号转义
+func codeColumnOf(col model.Column) model.Column {
+	if col.Default != "" && !defaultIsExpr(col) {
+		col.Default = "'" + escapeQuote(col.Default) + "'"
+	}
+	col.Comment = escapeQuote(col.Comment)
+	return col
+}
+
+// defaultIsExpr 默认值为表达式(CURRENT_TIMESTAMP 等)或已带引号(MariaDB)
+func defaultIsExpr(col model.Column) bool {
+	if strings.Contains(col.EXTRA, "DEFAULT_GENERATED") {
+		return true
+	}
+	value := strings.ToUpper(col.Default)
+	return strings.HasPrefix(value, "'") || strings.HasPrefix(value, "B'") || value == "NULL" ||
+		strings.HasPrefix(value, "CURRENT_TIMESTAMP") || strings.HasPrefix(value, "NOW(")
+}
+
+func escapeQuote(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
+
+func dropColumn(tableName string, col model.Column) []string {
+	return []string{fmt.Sprintf("ALTER TABLE `%s` DROP COLUMN `%s`", tableName, col.Field)}
 }
 
 func addIndex(tableName string, index model.Index) []string {
@@ -256,13 +585,47 @@ func addIndex(tableName string, index model.Index) []string {
 		sql += "index "
 	}
 	sql += " " + index.Name + " ("
+	sql += quoteColumns(index.Columns)
+	sql += ") "
 
-	for i, column := range index.Columns {
-		index.Columns[i] = "`" + column + "`"
-	}
+	return []string{sql}
+}
 
-	sql += strings.Join(index.Columns, ",")
-	sql += ") "
+func dropIndex(tableName string, index model.Index) []string {
+	return []string{fmt.Sprintf("ALTER TABLE `%s` DROP INDEX `%s`", tableName, index.Name)}
+}
 
+func addForeignKey(fk model.ForeignKey) []string {
+	sql := fmt.Sprintf("ALTER TABLE `%s` ADD CONSTRAINT `%s` FOREIGN KEY (%s) REFERENCES `%s` (%s) ON DELETE %s ON UPDATE %s",
+		fk.TableName, fk.Name, quoteColumns(fk.Columns), fk.RefTable, quoteColumns(fk.RefColumns), fk.OnDelete, fk.OnUpdate)
 	return []string{sql}
 }
+
+func dropForeignKey(fk model.ForeignKey) []string {
+	return []string{fmt.Sprintf("ALTER TABLE `%s` DROP FOREIGN KEY `%s`", fk.TableName, fk.Name)}
+}
+
+func addCheck(check model.Check) []string {
+	return []string{fmt.Sprintf("ALTER TABLE `%s` ADD CONSTRAINT `%s` CHECK (%s)", check.TableName, check.Name, check.Expr)}
+}
+
+func dropCheck(check model.Check) []string {
+	return []string{fmt.Sprintf("ALTER TABLE `%s` DROP CHECK `%s`", check.TableName, check.Name)}
+}
+
+func inList(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteColumns(columns []string) string {
+	var list []string
+	for _, column := range columns {
+		list = append(list, "`"+column+"`")
+	}
+	return strings.Join(list, ",")
+}
@@ -0,0 +1,125 @@
+package mysql_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/glennliao/table-sync/model"
+	"github.com/glennliao/table-sync/tablesync"
+)
+
+// 还原SQL使用数据库中的列定义: 字面量默认值加引号, 表达式默认值保持原样, 注释转义
+func TestDownRestoresColumn(t *testing.T) {
+	dbTable := model.Table{
+		Name:       "post",
+		PrimaryKey: []string{"id"},
+		Columns: []model.Column{
+			{Field: "id", Type: "bigint", NotNull: "not null", PrimaryKey: true},
+			{Field: "state", Type: "varchar(16)", NotNull: "not null", Default: "draft", Comment: "it's state"},
+			{Field: "created_at", Type: "datetime", NotNull: "not null", Default: "CURRENT_TIMESTAMP", EXTRA: "DEFAULT_GENERATED"},
+			{Field: "path", Type: "varchar(64)", NotNull: "null", Comment: `c:\tmp`},
+		},
+	}
+	codeTable := dbTable
+	codeTable.Columns = []model.Column{
+		dbTable.Columns[0],
+		{Field: "state", Type: "varchar(32)", NotNull: "not null", Default: "'draft'", Comment: `it\'s state`},
+	}
+
+	plan, err := tablesync.Diff(
+		model.Schema{Tables: map[string]*model.Table{"post": &dbTable}},
+		model.Schema{Tables: map[string]*model.Table{"post": &codeTable}},
+		"mysql",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	down := map[string]string{}
+	for _, item := range plan.Sql {
+		down[item.Kind+" "+item.Name] = strings.Join(item.Down, "\n")
+	}
+	tests := []struct {
+		item string
+		want []string
+	}{
+		{"AlterColumn state", []string{"varchar(16)", "DEFAULT 'draft'", `comment 'it\'s state'`}},
+		{"DropColumn created_at", []string{"add `created_at`", "DEFAULT CURRENT_TIMESTAMP"}},
+		{"DropColumn path", []string{"add `path`", `comment 'c:\\tmp'`}},
+	}
+	for _, tt := range tests {
+		sql, exists := down[tt.item]
+		if !exists {
+			t.Errorf("no %s in plan:\n%s", tt.item, plan)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(sql, want) {
+				t.Errorf("%s down should contain %s, got: %s", tt.item, want, sql)
+			}
+		}
+	}
+	if strings.Contains(down["DropColumn created_at"], "'CURRENT_TIMESTAMP'") {
+		t.Errorf("expression default should not be quoted: %s", down["DropColumn created_at"])
+	}
+}
+
+// 自增主键改为联合主键时先去掉 AUTO_INCREMENT 再替换主键, 回滚时替换主键后再加上
+func TestAlterAutoIncrementPrimaryKey(t *testing.T) {
+	dbTable := model.Table{
+		Name:       "order",
+		PrimaryKey: []string{"id"},
+		Columns: []model.Column{
+			{Field: "id", Type: "bigint", NotNull: "not null", PrimaryKey: true, EXTRA: "auto_increment"},
+			{Field: "user_id", Type: "bigint", NotNull: "not null"},
+		},
+	}
+	codeTable := dbTable
+	codeTable.PrimaryKey = []string{"id", "user_id"}
+	codeTable.Columns = []model.Column{
+		{Field: "id", Type: "bigint", NotNull: "not null", PrimaryKey: true, Comment: "id"},
+		{Field: "user_id", Type: "bigint", NotNull: "not null", PrimaryKey: true},
+	}
+
+	plan, err := tablesync.Diff(
+		model.Schema{Tables: map[string]*model.Table{"order": &dbTable}},
+		model.Schema{Tables: map[string]*model.Table{"order": &codeTable}},
+		"mysql",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found bool
+	for _, item := range plan.Sql {
+		switch item.Kind {
+		case model.KindAlterTable:
+			found = true
+			sql, down := strings.Join(item.Sql, "\n"), strings.Join(item.Down, "\n")
+			if strings.Contains(sql, "AUTO_INCREMENT") || !strings.Contains(sql, "MODIFY COLUMN `id`") ||
+				strings.Index(sql, "MODIFY COLUMN `id`") > strings.Index(sql, "DROP PRIMARY KEY") ||
+				!strings.HasSuffix(sql, "ADD PRIMARY KEY (`id`,`user_id`)") {
+				t.Errorf("should remove auto_increment before replacing primary key: %s", sql)
+			}
+			if !strings.Contains(down, "ADD PRIMARY KEY (`id`), MODIFY COLUMN `id`") || !strings.Contains(down, "AUTO_INCREMENT") {
+				t.Errorf("down should restore auto_increment after primary key: %s", down)
+			}
+		case model.KindAlterColumn:
+			if sql := strings.Join(item.Sql, "\n"); strings.Contains(sql, "AUTO_INCREMENT") {
+				t.Errorf("column in composite primary key should not auto increment: %s", sql)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("no %s in plan:\n%s", model.KindAlterTable, plan)
+	}
+
+	codeTable.OnlineDDL = model.OnlineDDLRequire
+	if _, err = tablesync.Diff(
+		model.Schema{Tables: map[string]*model.Table{"order": &dbTable}},
+		model.Schema{Tables: map[string]*model.Table{"order": &codeTable}},
+		"mysql",
+	); err == nil {
+		t.Error("changing auto_increment column should not be online")
+	}
+}
@@ -0,0 +1,203 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/glennliao/table-sync/database"
+	"github.com/glennliao/table-sync/model"
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/errors/gerror"
+)
+
+const algorithmInplace = "ALGORITHM=INPLACE, LOCK=NONE"
+
+// onlineDDL 按表的 OnlineDDL 策略为可在线执行的变更追加 ALGORITHM/LOCK 子句,
+// auto 时无法在线执行的变更保持原SQL由 MySQL 自行选择, require 时返回错误
+func (d *Mysql) onlineDDL(ctx context.Context, db gdb.DB, task model.SyncTask, list []model.SyncSql) ([]model.SyncSql, error) {
+	var instant *bool
+	instantAddColumn := func() bool {
+		if instant == nil {
+			supported := supportInstantAddColumn(ctx, db)
+			instant = &supported
+		}
+		return *instant
+	}
+
+	var created = map[string]struct{}{}
+	for _, table := range task.CreateTable {
+		created[table.Name] = struct{}{}
+	}
+
+	for i := range list {
+		item := &list[i]
+		table := task.SchemaInCode.Tables[item.Table]
+		if table == nil || table.OnlineDDL == "" {
+			continue
+		}
+		if table.OnlineDDL != model.OnlineDDLAuto && table.OnlineDDL != model.OnlineDDLRequire {
+			return nil, gerror.Newf("table %s: unsupported onlineDDL %s, use %s or %s", item.Table, table.OnlineDDL, model.OnlineDDLAuto, model.OnlineDDLRequire)
+		}
+		// 新建的表没有数据, 其上的操作无需在线执行
+		if _, exists := created[item.Table]; exists {
+			continue
+		}
+
+		clause, reason := onlineClause(task, *table, *item, instantAddColumn)
+		if reason != "" {
+			if table.OnlineDDL == model.OnlineDDLRequire {
+				return nil, gerror.Newf("table %s: %s %s can not be executed online (onlineDDL:require): %s", item.Table, item.Kind, item.Name, reason)
+			}
+			continue
+		}
+		if clause == "" {
+			continue
+		}
+		for j := range item.Sql {
+			item.Sql[j] = strings.TrimSpace(item.Sql[j]) + ", " + clause
+		}
+	}
+	return list, nil
+}
+
+// onlineClause 可在线执行时返回追加的子句(为空时不需要指定), 否则返回需要复制表或阻塞写入的原因
+func onlineClause(task model.SyncTask, table model.Table, item model.SyncSql, instantAddColumn func() bool) (clause string, reason string) {
+	switch item.Kind {
+	case model.KindRenameTable:
+		// RENAME TABLE 仅修改元数据
+		return "", ""
+	case model.KindAddColumn:
+		// 支持 INSTANT 时不指定, MySQL 优先使用 INSTANT, 不满足条件时使用 INPLACE, 均不阻塞写入
+		if instantAddColumn() {
+			return "", ""
+		}
+		return algorithmInplace, ""
+	case model.KindDropColumn, model.KindAddIndex, model.KindDropIndex, model.KindDropForeignKey, model.KindDropCheck:
+		return algorithmInplace, ""
+	case model.KindAddForeignKey:
+		return "", "add foreign key requires table copy unless foreign_key_checks is disabled"
+	case model.KindAddCheck:
+		return "", "add check constraint requires table copy"
+	case model.KindAlterColumn, model.KindRenameColumn:
+		column, _ := findColumn(table, item.Name)
+		dbColumn, _ := task.DBColumn(item.Table, task.DBColumnName(item.Table, item.Name))
+		var charset string
+		if dbTable := task.DBTable(item.Table); dbTable != nil {
+			charset = dbTable.Charset
+		}
+		if reason = alterColumnCopyReason(dbColumn, column, charset); reason != "" {
+			return "", reason
+		}
+		return algorithmInplace, ""
+	case model.KindAlterTable:
+		for _, alter := range task.AlterTable {
+			if alter.Table.Name != item.Table {
+				continue
+			}
+			if alter.Charset {
+				return "", "convert charset requires table copy"
+			}
+			if alter.PrimaryKey && len(alter.Table.PrimaryKey) == 0 {
+				return "", "drop primary key without adding one requires table copy"
+			}
+			if alter.PrimaryKey && autoIncrementChanged(alter.Table, task.DBTable(alter.Table.Name)) {
+				return "", "change auto_increment column requires table copy"
+			}
+		}
+		return algorithmInplace, ""
+	}
+	return "", item.Kind + " is not supported online"
+}
+
+// alterColumnCopyReason 修改列需要复制表(ALGORITHM=COPY)的原因, 可在线执行时返回空:
+// 仅修改注释/默认值/是否可空, 或 varchar 加长且长度字节数不变(均小于或均不小于256字节)
+func alterColumnCopyReason(dbColumn, codeColumn model.Column, charset string) string {
+	if strings.EqualFold(dbColumn.Type, codeColumn.Type) {
+		return ""
+	}
+	fromName, fromSize := database.SplitSqlType(dbColumn.Type)
+	toName, toSize := database.SplitSqlType(codeColumn.Type)
+	if fromName != "varchar" || toName != "varchar" {
+		return fmt.Sprintf("change type %s to %s requires table copy", dbColumn.Type, codeColumn.Type)
+	}
+	from, _ := strconv.Atoi(fromSize)
+	to, _ := strconv.Atoi(toSize)
+	if to < from {
+		return fmt.Sprintf("shorten %s to %s requires table copy", dbColumn.Type, codeColumn.Type)
+	}
+	bytes := charsetBytes(charset)
+	if from*bytes < 256 != (to*bytes < 256) {
+		return fmt.Sprintf("extend %s to %s changes length bytes (%s), requires table copy", dbColumn.Type, codeColumn.Type, charset)
+	}
+	return ""
+}
+
+// charsetBytes 字符集单个字符最大字节数
+func charsetBytes(charset string) int {
+	switch strings.ToLower(charset) {
+	case "latin1", "ascii", "binary":
+		return 1
+	case "utf8", "utf8mb3":
+		return 3
+	}
+	return 4
+}
+
+// autoIncrementChanged 修改主键时是否需要增加或去掉列的 AUTO_INCREMENT
+func autoIncrementChanged(table model.Table, dbTable *model.Table) bool {
+	if dbTable == nil {
+		return false
+	}
+	for _, column := range markAutoIncrement(table).Columns {
+		dbColumn, _ := findColumn(*dbTable, column.Field)
+		if isAutoIncrement(column) != isAutoIncrement(dbColumn) {
+			return true
+		}
+	}
+	return false
+}
+
+func findColumn(table model.Table, field string) (model.Column, bool) {
+	for _, column := range table.Columns {
+		if column.Field == field {
+			return column, true
+		}
+	}
+	return model.Column{}, false
+}
+
+var versionPattern = regexp.MustCompile(`^(\d+)\.(\d+)\.(\d+)`)
+
+// supportInstantAddColumn MySQL 8.0.12 / MariaDB 10.3.2 起支持 ALGORITHM=INSTANT 添加列,
+// 离线生成(db 为 nil)或无法获取版本时视为不支持
+func supportInstantAddColumn(ctx context.Context, db gdb.DB) bool {
+	if db == nil {
+		return false
+	}
+	value, err := db.GetValue(ctx, "SELECT VERSION()")
+	if err != nil {
+		return false
+	}
+	version := value.String()
+	match := versionPattern.FindStringSubmatch(version)
+	if match == nil {
+		return false
+	}
+	var v [3]int
+	for i := range v {
+		v[i], _ = strconv.Atoi(match[i+1])
+	}
+	min := [3]int{8, 0, 12}
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		min = [3]int{10, 3, 2}
+	}
+	for i := range v {
+		if v[i] != min[i] {
+			return v[i] > min[i]
+		}
+	}
+	return true
+}
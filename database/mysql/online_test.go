@@ -0,0 +1,233 @@
+package mysql_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/glennliao/table-sync/model"
+	"github.com/glennliao/table-sync/tablesync"
+)
+
+func orderTable() model.Table {
+	return model.Table{
+		Name:       "order",
+		Charset:    "utf8mb4",
+		PrimaryKey: []string{"id"},
+		Columns: []model.Column{
+			{Field: "id", Type: "bigint", NotNull: "not null", PrimaryKey: true},
+			{Field: "name", Type: "varchar(32)", NotNull: "not null"},
+			{Field: "user_id", Type: "bigint", NotNull: "not null"},
+		},
+		Index: []model.Index{{Name: "idx_name", Columns: []string{"name"}}},
+	}
+}
+
+func column(table *model.Table, field string) *model.Column {
+	for i := range table.Columns {
+		if table.Columns[i].Field == field {
+			return &table.Columns[i]
+		}
+	}
+	panic(field)
+}
+
+// 离线生成时添加列不能确认 INSTANT, 使用 INPLACE
+func TestOnlineDDL(t *testing.T) {
+	const inplace = ", ALGORITHM=INPLACE, LOCK=NONE"
+	tests := []struct {
+		name   string
+		kind   string
+		db     func(table *model.Table)
+		code   func(table *model.Table)
+		clause string // auto 时 kind 对应的SQL追加的子句
+		online bool   // require 时整个计划是否可执行
+	}{
+		{
+			name: "add column",
+			kind: model.KindAddColumn,
+			code: func(table *model.Table) {
+				table.Columns = append(table.Columns, model.Column{Field: "note", Type: "text", NotNull: "null"})
+			},
+			clause: inplace, online: true,
+		},
+		{
+			name: "drop column",
+			kind: model.KindDropColumn,
+			db: func(table *model.Table) {
+				table.Columns = append(table.Columns, model.Column{Field: "note", Type: "text", NotNull: "null"})
+			},
+			clause: inplace, online: true,
+		},
+		{
+			name: "rename column",
+			kind: model.KindRenameColumn,
+			code: func(table *model.Table) {
+				c := column(table, "name")
+				c.Field, c.DDLTag = "title", map[string]string{model.DDLWas: "name"}
+			},
+			clause: inplace, online: true,
+		},
+		{
+			name: "rename column and change type",
+			kind: model.KindRenameColumn,
+			code: func(table *model.Table) {
+				c := column(table, "name")
+				c.Field, c.Type, c.DDLTag = "title", "varchar(16)", map[string]string{model.DDLWas: "name"}
+			},
+			online: false,
+		},
+		{
+			name:   "extend varchar within length bytes",
+			kind:   model.KindAlterColumn,
+			code:   func(table *model.Table) { column(table, "name").Type = "varchar(48)" },
+			clause: inplace, online: true,
+		},
+		{
+			name:   "extend varchar across 255 bytes",
+			kind:   model.KindAlterColumn,
+			code:   func(table *model.Table) { column(table, "name").Type = "varchar(64)" },
+			online: false,
+		},
+		{
+			name: "extend varchar in latin1 table",
+			kind: model.KindAlterColumn,
+			db:   func(table *model.Table) { table.Charset = "latin1" },
+			code: func(table *model.Table) {
+				table.Charset = ""
+				column(table, "name").Type = "varchar(200)" // 按 utf8mb4 计算会超过255字节
+			},
+			clause: inplace, online: true,
+		},
+		{
+			name: "add index",
+			kind: model.KindAddIndex,
+			code: func(table *model.Table) {
+				table.Index = append(table.Index, model.Index{Name: "idx_user", Columns: []string{"user_id"}})
+			},
+			clause: inplace, online: true,
+		},
+		{
+			name:   "drop index",
+			kind:   model.KindDropIndex,
+			code:   func(table *model.Table) { table.Index = nil },
+			clause: inplace, online: true,
+		},
+		{
+			name:   "replace primary key",
+			kind:   model.KindAlterTable,
+			code:   func(table *model.Table) { table.PrimaryKey = []string{"id", "user_id"} },
+			clause: inplace, online: true,
+		},
+		{
+			name:   "convert charset",
+			kind:   model.KindAlterTable,
+			code:   func(table *model.Table) { table.Charset = "utf8mb3" },
+			online: false,
+		},
+		{
+			name: "add foreign key",
+			kind: model.KindAddForeignKey,
+			code: func(table *model.Table) {
+				table.ForeignKeys = []model.ForeignKey{{Name: "fk_order_user", Columns: []string{"user_id"}, RefTable: "user", RefColumns: []string{"id"}}}
+			},
+			online: false,
+		},
+		{
+			// 外键变更时先删除再添加, 添加外键需要复制表
+			name: "drop foreign key",
+			kind: model.KindDropForeignKey,
+			db: func(table *model.Table) {
+				table.ForeignKeys = []model.ForeignKey{{Name: "fk_order_user", Columns: []string{"user_id"}, RefTable: "user", RefColumns: []string{"id"}}}
+			},
+			code: func(table *model.Table) {
+				table.ForeignKeys = []model.ForeignKey{{Name: "fk_order_user", Columns: []string{"user_id"}, RefTable: "user", RefColumns: []string{"id"}, OnDelete: "CASCADE"}}
+			},
+			clause: inplace, online: false,
+		},
+		{
+			name:   "add check",
+			kind:   model.KindAddCheck,
+			code:   func(table *model.Table) { table.Checks = []model.Check{{Name: "chk_order_id", Expr: "id > 0"}} },
+			online: false,
+		},
+		{
+			name:   "drop check",
+			kind:   model.KindDropCheck,
+			db:     func(table *model.Table) { table.Checks = []model.Check{{Name: "chk_order_id", Expr: "id > 0"}} },
+			code:   func(table *model.Table) { table.Checks = []model.Check{{Name: "chk_order_id", Expr: "id > 1"}} },
+			clause: inplace, online: false,
+		},
+	}
+
+	for _, tt := range tests {
+		for _, policy := range []string{model.OnlineDDLAuto, model.OnlineDDLRequire} {
+			dbTable, codeTable := orderTable(), orderTable()
+			if tt.db != nil {
+				tt.db(&dbTable)
+			}
+			if tt.code != nil {
+				tt.code(&codeTable)
+			}
+			codeTable.OnlineDDL = policy
+			from := model.Schema{Tables: map[string]*model.Table{"order": &dbTable}}
+			to := model.Schema{Tables: map[string]*model.Table{"order": &codeTable}}
+
+			plan, err := tablesync.Diff(from, to, "mysql")
+			if policy == model.OnlineDDLRequire && !tt.online {
+				if err == nil {
+					t.Errorf("%s: require should fail, got:\n%s", tt.name, plan)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s/%s: %v", tt.name, policy, err)
+				continue
+			}
+
+			var found bool
+			for _, item := range plan.Sql {
+				if item.Kind != tt.kind {
+					continue
+				}
+				found = true
+				for _, sql := range item.Sql {
+					if got := strings.Contains(sql, "ALGORITHM="); got != (tt.clause != "") || tt.clause != "" && !strings.HasSuffix(sql, tt.clause) {
+						t.Errorf("%s/%s: want clause %q, got %s", tt.name, policy, tt.clause, sql)
+					}
+				}
+			}
+			if !found {
+				t.Errorf("%s/%s: no %s in plan:\n%s", tt.name, policy, tt.kind, plan)
+			}
+		}
+	}
+}
+
+// 新建的表及未设置策略的表不追加子句, 不支持的策略返回错误
+func TestOnlineDDLPolicy(t *testing.T) {
+	table := orderTable()
+	table.OnlineDDL = model.OnlineDDLRequire
+	table.ForeignKeys = []model.ForeignKey{{Name: "fk_order_user", Columns: []string{"user_id"}, RefTable: "user", RefColumns: []string{"id"}}}
+	plan, err := tablesync.Diff(model.Schema{}, model.Schema{Tables: map[string]*model.Table{"order": &table}}, "mysql")
+	if err != nil {
+		t.Fatalf("create table should not require online ddl: %v", err)
+	}
+	if sql := strings.Join(plan.SqlList(), "\n"); strings.Contains(sql, "ALGORITHM=") {
+		t.Errorf("create table should not get clause:\n%s", sql)
+	}
+
+	dbTable, codeTable := orderTable(), orderTable()
+	column(&codeTable, "name").Type = "varchar(16)"
+	plan, err = tablesync.Diff(model.Schema{Tables: map[string]*model.Table{"order": &dbTable}}, model.Schema{Tables: map[string]*model.Table{"order": &codeTable}}, "mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sql := strings.Join(plan.SqlList(), "\n"); strings.Contains(sql, "ALGORITHM=") {
+		t.Errorf("table without policy should not get clause:\n%s", sql)
+	}
+
+	codeTable.OnlineDDL = "fast"
+	if _, err = tablesync.Diff(model.Schema{Tables: map[string]*model.Table{"order": &dbTable}}, model.Schema{Tables: map[string]*model.Table{"order": &codeTable}}, "mysql"); err == nil {
+		t.Error("unsupported policy should fail")
+	}
+}
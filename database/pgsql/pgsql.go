@@ -3,8 +3,10 @@ package pgsql
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/glennliao/table-sync/database"
 	"github.com/glennliao/table-sync/model"
@@ -15,13 +17,7 @@ func init() {
 	database.RegDatabase(`pgsql`, &Pgsql{})
 }
 
-type Pgsql struct {
-	schema string // TODO 支持自定义schema
-}
-
-func (d *Pgsql) Schema(schema string) {
-	d.schema = schema
-}
+type Pgsql struct{}
 
 var goTypeMap = map[string]string{
 	"string":        "varchar",     //
@@ -72,56 +68,173 @@ func (d *Pgsql) GetSqlType(ctx context.Context, goType string, size string) stri
 	return goType
 }
 
-const (
-	defaultSchema = "public"
-)
+func (d *Pgsql) GetGoType(ctx context.Context, sqlType string) (string, string) {
+	name, size := database.SplitSqlType(sqlType)
+	if name != "varchar" {
+		size = ""
+	}
+	return goType(name), size
+}
 
-// LoadSchema 获取数据库结构
+// LoadSchema 获取 public schema 的数据库结构
 func (d *Pgsql) LoadSchema(ctx context.Context, db gdb.DB) (schema model.Schema, err error) {
+	return d.LoadSchemas(ctx, db, []string{model.PublicSchema})
+}
+
+// LoadSchemas 获取指定 schema 的数据库结构, public 以外的表名为 schema.table
+func (d *Pgsql) LoadSchemas(ctx context.Context, db gdb.DB, schemas []string) (schema model.Schema, err error) {
+	var tableMap = map[string]*model.Table{}
+	var loaded = map[string]struct{}{}
+	for _, name := range schemas {
+		if _, exists := loaded[name]; exists {
+			continue
+		}
+		loaded[name] = struct{}{}
+		if err = d.loadSchemaTables(ctx, db, name, tableMap); err != nil {
+			return
+		}
+	}
+
+	return model.Schema{
+		Tables:    tableMap,
+		NoComment: false,
+	}, nil
+}
 
-	//dbConfig := db.GetConfig()
-	//dbName := dbConfig.Name
-	//if dbName == "" && dbConfig.Link != "" {
-	//	dbName = strings.Split(strings.Split(dbConfig.Link, "/")[1], "?")[0]
-	//}
+// loadSchemaTables 加载单个 schema 中的表
+func (d *Pgsql) loadSchemaTables(ctx context.Context, db gdb.DB, schema string, tableMap map[string]*model.Table) (err error) {
+	tables, err := d.loadTables(ctx, db, schema)
+	if err != nil {
+		return
+	}
 
-	if d.schema == "" {
-		d.schema = defaultSchema
+	idxes, err := d.loadIndex(ctx, db, schema)
+	if err != nil {
+		return
 	}
 
-	tables, err := d.loadTables(ctx, db, d.schema)
+	columns, err := d.loadColumns(ctx, db, schema)
 	if err != nil {
 		return
 	}
 
-	idxes, err := d.loadIndex(ctx, db, d.schema)
+	primaryKeys, err := d.loadPrimaryKey(ctx, db, schema)
 	if err != nil {
-		return schema, nil
+		return
 	}
 
-	columns, err := d.loadColumns(ctx, db, d.schema)
+	foreignKeys, err := d.loadForeignKey(ctx, db, schema)
 	if err != nil {
-		return schema, nil
+		return
+	}
+
+	checks, err := d.loadCheck(ctx, db, schema)
+	if err != nil {
+		return
+	}
+
+	var checkMap = map[string][]model.Check{}
+	for _, check := range checks {
+		checkMap[check.TableName] = append(checkMap[check.TableName], check)
+	}
+
+	var foreignKeyMap = map[string][]model.ForeignKey{}
+	for _, fk := range foreignKeys {
+		foreignKeyMap[fk.TableName] = append(foreignKeyMap[fk.TableName], fk)
 	}
 
 	var idxMap, columnMap = d.formatIndex(idxes), d.formatColumns(columns)
 
-	var tableMap = map[string]*model.Table{}
+	var primaryKeyMap, primaryKeyNameMap = map[string][]string{}, map[string]string{}
+	for _, c := range primaryKeys {
+		primaryKeyMap[c.Table] = append(primaryKeyMap[c.Table], c.ColumnName)
+		primaryKeyNameMap[c.Table] = c.IndexName
+	}
+
 	for _, table := range tables {
 		name := table.Name
+		qualified := model.QualifiedName(schema, name)
+
+		t := &model.Table{
+			Name:           qualified,
+			Comment:        table.Comment,
+			Charset:        table.Charset,
+			PrimaryKey:     primaryKeyMap[name],
+			PrimaryKeyName: primaryKeyNameMap[name],
+			Columns:        columnMap[name],
+			Index:          idxMap[name],
+			ForeignKeys:    foreignKeyMap[name],
+			Checks:         checkMap[name],
+		}
 
-		tableMap[name] = &model.Table{
-			Name:    name,
-			Comment: table.Comment,
-			Charset: table.Charset,
-			Columns: columnMap[name],
-			Index:   idxMap[name],
+		for i, column := range t.Columns {
+			t.Columns[i].TableName = qualified
+			for _, field := range primaryKeyMap[name] {
+				if column.Field == field {
+					t.Columns[i].PrimaryKey = true
+				}
+			}
+		}
+		for i := range t.Index {
+			t.Index[i].TableName = qualified
 		}
+		for i := range t.ForeignKeys {
+			t.ForeignKeys[i].TableName = qualified
+		}
+		for i := range t.Checks {
+			t.Checks[i].TableName = qualified
+		}
+		tableMap[qualified] = t
 	}
 
-	return model.Schema{
-		Tables:    tableMap,
-		NoComment: false,
+	return nil
+}
+
+// quoteTable "schema"."table", public 中的表省略 schema
+func (d *Pgsql) quoteTable(name string) string {
+	schema, table := model.SplitQualifiedName(name)
+	if schema == "" || schema == model.PublicSchema {
+		return fmt.Sprintf(`"%s"`, table)
+	}
+	return fmt.Sprintf(`"%s"."%s"`, schema, table)
+}
+
+// quoteIndex 索引与表在同一 schema
+func (d *Pgsql) quoteIndex(tableName string, name string) string {
+	schema, _ := model.SplitQualifiedName(tableName)
+	return d.quoteTable(model.QualifiedName(schema, name))
+}
+
+// bareName 不带 schema 的表名, 用于 RENAME TO 及默认约束名
+func bareName(name string) string {
+	_, table := model.SplitQualifiedName(name)
+	return table
+}
+
+// Lock 会话级 advisory lock, 使用独立连接持有直到释放
+func (d *Pgsql) Lock(ctx context.Context, db gdb.DB, name string, timeout time.Duration) (func(ctx context.Context) error, error) {
+	master, err := db.Master()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := master.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.WaitLock(ctx, name, timeout, func() (locked bool, err error) {
+		err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", name).Scan(&locked)
+		return
+	})
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return func(ctx context.Context) error {
+		defer conn.Close()
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtext($1))", name)
+		return err
 	}, nil
 }
 
@@ -148,6 +261,7 @@ type Column struct {
 	Length     int    `orm:"length"`   // 字段长度
 	Typmod     int    `orm:"typmod"`   // 字段长度
 	Comment    string `orm:"comment"`  // 字段注释
+	Default    string `orm:"default"`  // 默认值表达式
 	Table      string `orm:"table"`    // 表名
 	Num        int    `orm:"num"`      // 字段序号
 	Conkey     []int  `orm:"conkey"`   // 主键字段序号
@@ -165,13 +279,15 @@ SELECT
     a.atttypmod AS typmod,
     a.attnotnull AS not_null,
     c.relname AS table,
-    d.description AS comment
+    d.description AS comment,
+    pg_get_expr(ad.adbin, ad.adrelid) AS default
 FROM
     pg_attribute a
     JOIN pg_class c ON a.attrelid = c.oid
     JOIN pg_namespace n ON c.relnamespace = n.oid
     JOIN pg_type t ON a.atttypid = t.oid
     LEFT JOIN pg_description d ON d.objoid = a.attrelid AND d.objsubid = a.attnum
+    LEFT JOIN pg_attrdef ad ON ad.adrelid = a.attrelid AND ad.adnum = a.attnum
 -- 	LEFT JOIN pg_constraint con ON c.oid = con.conrelid AND n.oid = con.connamespace
 WHERE
     a.attnum > 0
@@ -213,15 +329,21 @@ func (d *Pgsql) formatColumns(columns []Column) map[string][]model.Column {
 			}
 		}
 
+		// serial 列的默认值为 nextval(...), 由序列管理, 不参与比较
+		_default, extra := columnDefault(column.Default), ""
+		if strings.HasPrefix(column.Default, "nextval(") {
+			_default, extra = "", "auto_increment"
+		}
+
 		columnMap[column.Table] = append(columnMap[column.Table], model.Column{
 			Field:      column.Field,
-			Type:       goType(column.Type),
+			Type:       sqlType(column.Type, size),
 			Kind:       "",
 			Comment:    column.Comment,
 			TableName:  column.Table,
-			Default:    "",
+			Default:    _default,
 			NotNull:    notNull,
-			EXTRA:      "",
+			EXTRA:      extra,
 			Size:       strconv.Itoa(size),
 			PrimaryKey: column.PrimaryKey,
 			DDLTag:     nil,
@@ -230,6 +352,19 @@ func (d *Pgsql) formatColumns(columns []Column) map[string][]model.Column {
 	return columnMap
 }
 
+var castLiteral = regexp.MustCompile(`^('(?:[^']|'')*'|NULL)::[\w\s"\[\]().,]+$`)
+
+// columnDefault 去掉字面量默认值的类型转换, 如 'draft'::character varying 为 'draft'
+func columnDefault(expr string) string {
+	if m := castLiteral.FindStringSubmatch(expr); m != nil {
+		expr = m[1]
+	}
+	if strings.ToUpper(expr) == "NULL" {
+		return ""
+	}
+	return expr
+}
+
 var dbTypeMap = map[string]string{
 	"int2":        "int",
 	"int4":        "int",
@@ -246,13 +381,29 @@ var dbTypeMap = map[string]string{
 	"timetz":      "time.Time",
 	"date":        "time.Time",
 	"interval":    "time.Duration",
+	"bool":        "bool",
 	"boolean":     "bool",
 	"json":        "string",
 	"jsonb":       "[]byte",
 }
 
+// sqlType 还原带长度/精度的列类型, 与 GetSqlType 生成的类型一致
+func sqlType(typeName string, size int) string {
+	switch typeName {
+	case "varchar", "bpchar":
+		if size > 0 {
+			return fmt.Sprintf("%s(%d)", strings.TrimPrefix(typeName, "bp"), size)
+		}
+	case "numeric":
+		if size > 0 {
+			return fmt.Sprintf("numeric(%d,%d)", size>>16, size&0xffff)
+		}
+	}
+	return typeName
+}
+
 func goType(dbType string) string {
-	if strings.HasPrefix("_", dbType) {
+	if strings.HasPrefix(dbType, "_") {
 		return "[]" + goType(dbType[1:])
 	}
 
@@ -267,6 +418,7 @@ type Index struct {
 	IndexName  string `orm:"index_name"`
 	ColumnName string `orm:"column_name"`
 	IsUnique   bool   `orm:"is_unique"`
+	IsValid    bool   `orm:"is_valid"`
 	Table      string `orm:"table"`
 }
 
@@ -276,7 +428,8 @@ SELECT
     t.relname AS table,
     i.relname AS index_name,
     a.attname AS column_name,
-    ix.indisunique AS is_unique
+    ix.indisunique AS is_unique,
+    ix.indisvalid AS is_valid
 FROM
     pg_index ix
     JOIN pg_class i ON ix.indexrelid = i.oid
@@ -285,6 +438,9 @@ FROM
     JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = ANY(ix.indkey)
 WHERE
     ns.nspname = ?
+    AND NOT ix.indisprimary
+ORDER BY
+    t.relname, i.relname, array_position(ix.indkey::int2[], a.attnum)
 `
 
 	err = db.GetScan(ctx, &columns, sql, schema)
@@ -295,6 +451,137 @@ WHERE
 	return columns, nil
 }
 
+// loadPrimaryKey 主键列, 按主键顺序
+func (d *Pgsql) loadPrimaryKey(ctx context.Context, db gdb.DB, schema string) (columns []Index, err error) {
+	sql := `
+SELECT
+    c.relname AS table,
+    con.conname AS index_name,
+    a.attname AS column_name
+FROM
+    pg_constraint con
+    JOIN pg_class c ON con.conrelid = c.oid
+    JOIN pg_namespace ns ON c.relnamespace = ns.oid
+    JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum = ANY(con.conkey)
+WHERE
+    con.contype = 'p'
+    AND ns.nspname = ?
+ORDER BY
+    c.relname, array_position(con.conkey, a.attnum)
+`
+
+	err = db.GetScan(ctx, &columns, sql, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	return columns, nil
+}
+
+// 外键动作 pg_constraint.confdeltype/confupdtype
+var foreignKeyActionMap = map[string]string{
+	"a": "NO ACTION",
+	"r": "RESTRICT",
+	"c": "CASCADE",
+	"n": "SET NULL",
+	"d": "SET DEFAULT",
+}
+
+func (d *Pgsql) loadForeignKey(ctx context.Context, db gdb.DB, schema string) (list []model.ForeignKey, err error) {
+	sql := `
+SELECT
+    con.conname AS name,
+    c.relname AS table_name,
+    rc.relname AS ref_table,
+    (SELECT string_agg(a.attname, ',' ORDER BY array_position(con.conkey, a.attnum)) FROM pg_attribute a WHERE a.attrelid = con.conrelid AND a.attnum = ANY(con.conkey)) AS columns,
+    (SELECT string_agg(a.attname, ',' ORDER BY array_position(con.confkey, a.attnum)) FROM pg_attribute a WHERE a.attrelid = con.confrelid AND a.attnum = ANY(con.confkey)) AS ref_columns,
+    rns.nspname AS ref_schema,
+    con.confdeltype AS on_delete,
+    con.confupdtype AS on_update
+FROM
+    pg_constraint con
+    JOIN pg_class c ON con.conrelid = c.oid
+    JOIN pg_namespace ns ON c.relnamespace = ns.oid
+    JOIN pg_class rc ON con.confrelid = rc.oid
+    JOIN pg_namespace rns ON rc.relnamespace = rns.oid
+WHERE
+    con.contype = 'f'
+    AND ns.nspname = ?
+`
+
+	type ForeignKey struct {
+		Name       string `orm:"name"`
+		TableName  string `orm:"table_name"`
+		RefTable   string `orm:"ref_table"`
+		RefSchema  string `orm:"ref_schema"`
+		Columns    string `orm:"columns"`
+		RefColumns string `orm:"ref_columns"`
+		OnDelete   string `orm:"on_delete"`
+		OnUpdate   string `orm:"on_update"`
+	}
+
+	var fkList []ForeignKey
+	err = db.GetScan(ctx, &fkList, sql, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fk := range fkList {
+		list = append(list, model.ForeignKey{
+			Name:       fk.Name,
+			TableName:  fk.TableName,
+			Columns:    strings.Split(fk.Columns, ","),
+			RefTable:   model.QualifiedName(fk.RefSchema, fk.RefTable),
+			RefColumns: strings.Split(fk.RefColumns, ","),
+			OnDelete:   foreignKeyActionMap[fk.OnDelete],
+			OnUpdate:   foreignKeyActionMap[fk.OnUpdate],
+		})
+	}
+
+	return list, nil
+}
+
+func (d *Pgsql) loadCheck(ctx context.Context, db gdb.DB, schema string) (list []model.Check, err error) {
+	sql := `
+SELECT
+    con.conname AS name,
+    c.relname AS table_name,
+    pg_get_constraintdef(con.oid) AS expr
+FROM
+    pg_constraint con
+    JOIN pg_class c ON con.conrelid = c.oid
+    JOIN pg_namespace ns ON c.relnamespace = ns.oid
+WHERE
+    con.contype = 'c'
+    AND ns.nspname = ?
+`
+
+	type Check struct {
+		Name      string `orm:"name"`
+		TableName string `orm:"table_name"`
+		Expr      string `orm:"expr"`
+	}
+
+	var checkList []Check
+	err = db.GetScan(ctx, &checkList, sql, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	// CHECK ((expr)) [NOT VALID]
+	for _, check := range checkList {
+		expr := strings.TrimSuffix(check.Expr, " NOT VALID")
+		expr = strings.TrimPrefix(expr, "CHECK ")
+		list = append(list, model.Check{
+			Name:      check.Name,
+			TableName: check.TableName,
+			Expr:      expr,
+		})
+	}
+
+	return list, nil
+}
+
 func (d *Pgsql) formatIndex(idxes []Index) map[string][]model.Index {
 	type idxKey struct {
 		TableName string
@@ -302,6 +589,7 @@ func (d *Pgsql) formatIndex(idxes []Index) map[string][]model.Index {
 	}
 	type idxValue struct {
 		Unique  bool
+		Invalid bool
 		Columns []string
 	}
 
@@ -314,6 +602,7 @@ func (d *Pgsql) formatIndex(idxes []Index) map[string][]model.Index {
 
 		v := indexMap[key]
 		v.Unique = c.IsUnique
+		v.Invalid = !c.IsValid
 		v.Columns = append(v.Columns, c.ColumnName)
 		indexMap[key] = v
 	}
@@ -325,6 +614,7 @@ func (d *Pgsql) formatIndex(idxes []Index) map[string][]model.Index {
 			Name:      t.IndexName,
 			Unique:    index.Unique,
 			Columns:   index.Columns,
+			Invalid:   index.Invalid,
 		})
 	}
 
@@ -332,24 +622,133 @@ func (d *Pgsql) formatIndex(idxes []Index) map[string][]model.Index {
 }
 
 // GetSyncSql 更新数据库结构
-func (d *Pgsql) GetSyncSql(ctx context.Context, db gdb.DB, task model.SyncTask) (list []string, err error) {
+func (d *Pgsql) GetSyncSql(ctx context.Context, db gdb.DB, task model.SyncTask) (list []model.SyncSql, err error) {
+
+	for _, rename := range task.RenameTable {
+		list = append(list, model.SyncSql{Table: rename.To, Kind: model.KindRenameTable, Sql: d.renameTable(rename),
+			Down: d.renameTable(model.TableRename{From: rename.To, To: rename.From})})
+	}
+
+	for _, fk := range task.DropForeignKey {
+		list = append(list, model.SyncSql{Table: fk.TableName, Kind: model.KindDropForeignKey, Name: fk.Name, Sql: d.dropForeignKey(fk), Down: d.addForeignKey(fk)})
+	}
+
+	for _, check := range task.DropCheck {
+		list = append(list, model.SyncSql{Table: check.TableName, Kind: model.KindDropCheck, Name: check.Name, Sql: d.dropConstraint(check.TableName, check.Name), Down: d.addCheck(check)})
+	}
 
+	var createdSchema = map[string]struct{}{}
 	for _, table := range task.CreateTable {
-		list = append(list, d.createTable(ctx, table)...)
+		sql := d.createTable(ctx, table)
+		if schema, _ := model.SplitQualifiedName(table.Name); schema != "" {
+			if _, exists := createdSchema[schema]; !exists {
+				createdSchema[schema] = struct{}{}
+				sql = append([]string{fmt.Sprintf(`CREATE SCHEMA IF NOT EXISTS "%s"`, schema)}, sql...)
+			}
+		}
+		list = append(list, model.SyncSql{Table: table.Name, Kind: model.KindCreateTable, Sql: sql, Down: d.dropTable(table.Name)})
+	}
+
+	for _, alter := range task.AlterTable {
+		dbTable := task.DBTable(alter.Table.Name)
+
+		// 还原为数据库中原有的表属性, 此时表已是新名称
+		var downTable model.Table
+		if dbTable != nil {
+			downTable = *dbTable
+			downTable.Name = alter.Table.Name
+		}
+
+		var sqlList, downList []string
+		if alter.PrimaryKey {
+			sqlList = append(sqlList, d.alterPrimaryKey(alter.Table, dbTable)...)
+			downList = append(downList, d.alterPrimaryKey(downTable, &alter.Table)...)
+		}
+		if alter.Comment {
+			sqlList = append(sqlList, d.tableComment(alter.Table)...)
+			downList = append(downList, d.tableComment(downTable)...)
+		}
+		if len(sqlList) > 0 {
+			list = append(list, model.SyncSql{Table: alter.Table.Name, Kind: model.KindAlterTable, Sql: sqlList, Down: downList})
+		}
+	}
+
+	for _, rename := range task.RenameColumn {
+		list = append(list, model.SyncSql{Table: rename.TableName, Kind: model.KindRenameColumn, Name: rename.Column.Field, Sql: d.renameColumn(rename),
+			Down: d.renameColumn(model.ColumnRename{TableName: rename.TableName, From: rename.Column.Field, Column: model.Column{Field: rename.From}})})
 	}
 
 	for _, column := range task.AddColumn {
-		list = append(list, d.addColumn(column)...)
+		list = append(list, model.SyncSql{Table: column.TableName, Kind: model.KindAddColumn, Name: column.Field, Sql: d.addColumn(column), Down: d.dropColumn(column)})
 	}
 
 	for _, column := range task.AlterColumn {
-		list = append(list, d.alterColumn(ctx, column)...)
+		item := model.SyncSql{Table: column.TableName, Kind: model.KindAlterColumn, Name: column.Field}
+		// 重命名的列在数据库中为原列名
+		field := column.Field
+		for _, rename := range task.RenameColumn {
+			if rename.TableName == column.TableName && rename.Column.Field == column.Field {
+				field = rename.From
+			}
+		}
+		if dbCol, exists := task.DBColumn(column.TableName, field); exists {
+			dbCol.TableName, dbCol.Field = column.TableName, column.Field
+			item.Down = d.alterColumn(ctx, dbCol)
+			if dbCol.EXTRA == "auto_increment" {
+				column.EXTRA = dbCol.EXTRA
+			}
+		}
+		item.Sql = d.alterColumn(ctx, column)
+		list = append(list, item)
 	}
 
+	// 并发创建时, 列变更的索引以临时名称创建后替换, 原索引在事务中保留
+	var recreateIndex = map[string]model.Index{}
+	for _, index := range task.DropIndex {
+		if task.ConcurrentIndex && hasIndex(task.AddIndex, index) {
+			recreateIndex[index.TableName+"."+index.Name] = index
+			continue
+		}
+		list = append(list, model.SyncSql{Table: index.TableName, Kind: model.KindDropIndex, Name: index.Name, Sql: d.dropIndex(index), Down: d.addIndex2(index)})
+	}
+
+	for _, column := range task.DropColumn {
+		list = append(list, model.SyncSql{Table: column.TableName, Kind: model.KindDropColumn, Name: column.Field, Sql: d.dropColumn(column), Down: d.addColumn(column)})
+	}
+
+	// CONCURRENTLY 不能在事务中执行, 放到最后在事务提交后执行
+	var concurrentIndex []model.SyncSql
 	for _, index := range task.AddIndex {
-		list = append(list, d.addIndex2(index)...)
+		if dbIndex, exists := recreateIndex[index.TableName+"."+index.Name]; exists {
+			concurrentIndex = append(concurrentIndex, model.SyncSql{Table: index.TableName, Kind: model.KindAddIndex, Name: index.Name,
+				Sql: d.replaceIndexConcurrently(index), Down: d.replaceIndexConcurrently(dbIndex), NoTx: true, Cleanup: d.dropTempIndex(index)})
+			continue
+		}
+		if task.ConcurrentIndex {
+			concurrentIndex = append(concurrentIndex, model.SyncSql{Table: index.TableName, Kind: model.KindAddIndex, Name: index.Name,
+				Sql: d.addIndexConcurrently(index), Down: d.dropIndexIfExists(index), NoTx: true, Cleanup: d.dropIndexIfExists(index)})
+			continue
+		}
+		list = append(list, model.SyncSql{Table: index.TableName, Kind: model.KindAddIndex, Name: index.Name, Sql: d.addIndex2(index), Down: d.dropIndex(index)})
+	}
+
+	// 外键在所有表创建完成后添加, 避免引用的表尚未创建
+	var addForeignKeys []model.ForeignKey
+	for _, table := range task.CreateTable {
+		for _, fk := range table.ForeignKeys {
+			fk.TableName = table.Name
+			addForeignKeys = append(addForeignKeys, fk)
+		}
+	}
+	for _, fk := range append(addForeignKeys, task.AddForeignKey...) {
+		list = append(list, model.SyncSql{Table: fk.TableName, Kind: model.KindAddForeignKey, Name: fk.Name, Sql: d.addForeignKey(fk), Down: d.dropForeignKey(fk)})
+	}
+
+	for _, check := range task.AddCheck {
+		list = append(list, model.SyncSql{Table: check.TableName, Kind: model.KindAddCheck, Name: check.Name, Sql: d.addCheck(check), Down: d.dropConstraint(check.TableName, check.Name)})
 	}
 
+	list = append(list, concurrentIndex...)
 	return
 }
 
@@ -361,16 +760,13 @@ func (d *Pgsql) createTable(ctx context.Context, table model.Table) []string {
 	)
 
 	name := table.Name
-	comments = append(comments, fmt.Sprintf(`COMMENT ON TABLE "%s" IS '%s'`, name, table.Comment))
+	comments = append(comments, d.tableComment(table)...)
 
 	for _, column := range table.Columns {
 		field := column.Field
 		_type := column.Type
 
 		var opts []string
-		if column.PrimaryKey {
-			primaryKey = append(primaryKey, field)
-		}
 		if strings.ToUpper(column.NotNull) == "NOT NULL" {
 			opts = append(opts, "NOT NULL")
 		}
@@ -378,7 +774,7 @@ func (d *Pgsql) createTable(ctx context.Context, table model.Table) []string {
 			opts = append(opts, fmt.Sprintf("DEFAULT %s", column.Default))
 		}
 		if column.Comment != "" {
-			comments = append(comments, fmt.Sprintf(`COMMENT ON COLUMN "%s"."%s" IS '%s'`, name, field, column.Comment))
+			comments = append(comments, fmt.Sprintf(`COMMENT ON COLUMN %s."%s" IS %s`, d.quoteTable(name), field, quoteComment(column.Comment)))
 		}
 		//_type = d.GetSqlType(ctx, _type, column.Size)
 		for k, _ := range column.DDLTag {
@@ -390,17 +786,22 @@ func (d *Pgsql) createTable(ctx context.Context, table model.Table) []string {
 		fields = append(fields, fmt.Sprintf("%s %s %s", field, _type, strings.Join(opts, " ")))
 	}
 
+	primaryKey = table.PrimaryKey
 	if len(primaryKey) > 0 {
 		fields = append(fields, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(primaryKey, ",")))
 	}
 
+	for _, check := range table.Checks {
+		fields = append(fields, fmt.Sprintf(`CONSTRAINT "%s" CHECK (%s)`, check.Name, check.Expr))
+	}
+
 	var index []string
 	for _, idx := range table.Index {
 		index = append(index, d.addIndex(name, idx)...)
 	}
 
 	var sql []string
-	tableSql := fmt.Sprintf("CREATE TABLE %s ( %s )", name, strings.Join(fields, ", "))
+	tableSql := fmt.Sprintf("CREATE TABLE %s ( %s )", d.quoteTable(name), strings.Join(fields, ", "))
 	sql = append(sql, tableSql)
 	sql = append(sql, index...)
 	sql = append(sql, comments...)
@@ -408,6 +809,44 @@ func (d *Pgsql) createTable(ctx context.Context, table model.Table) []string {
 	return sql
 }
 
+// quoteComment 注释字符串, 代码中的单引号已转义为反斜杠加单引号, pgsql(standard_conforming_strings=on)中需写为两个单引号
+func quoteComment(comment string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(comment, `\'`, `'`), "'", "''") + "'"
+}
+
+func (d *Pgsql) tableComment(table model.Table) []string {
+	return []string{fmt.Sprintf(`COMMENT ON TABLE %s IS %s`, d.quoteTable(table.Name), quoteComment(table.Comment))}
+}
+
+// alterPrimaryKey 按数据库中的约束名删除原主键(表重命名后约束名不变), 未知时为默认命名 表名_pkey,
+// 还原时按原约束名重建
+func (d *Pgsql) alterPrimaryKey(table model.Table, dbTable *model.Table) []string {
+	var sql []string
+	if dbTable != nil && len(dbTable.PrimaryKey) > 0 {
+		name := dbTable.PrimaryKeyName
+		if name == "" {
+			name = bareName(dbTable.Name) + "_pkey"
+		}
+		sql = append(sql, fmt.Sprintf(`ALTER TABLE %s DROP CONSTRAINT "%s"`, d.quoteTable(table.Name), name))
+	}
+	if len(table.PrimaryKey) > 0 {
+		constraint := ""
+		if table.PrimaryKeyName != "" {
+			constraint = fmt.Sprintf(`CONSTRAINT "%s" `, table.PrimaryKeyName)
+		}
+		sql = append(sql, fmt.Sprintf(`ALTER TABLE %s ADD %sPRIMARY KEY ("%s")`, d.quoteTable(table.Name), constraint, strings.Join(table.PrimaryKey, `", "`)))
+	}
+	return sql
+}
+
+func (d *Pgsql) dropTable(tableName string) []string {
+	return []string{fmt.Sprintf(`DROP TABLE %s`, d.quoteTable(tableName))}
+}
+
+func (d *Pgsql) renameTable(rename model.TableRename) []string {
+	return []string{fmt.Sprintf(`ALTER TABLE %s RENAME TO "%s"`, d.quoteTable(rename.From), bareName(rename.To))}
+}
+
 func (d *Pgsql) addColumn(column model.Column) []string {
 	var (
 		tableName = column.TableName
@@ -422,8 +861,8 @@ func (d *Pgsql) addColumn(column model.Column) []string {
 		opts = append(opts, fmt.Sprintf("DEFAULT %s", column.Default))
 	}
 
-	sql := fmt.Sprintf(`ALTER TABLE "%s" ADD COLUMN "%s" %s %s`, tableName, field, column.Type, strings.Join(opts, " "))
-	comment := fmt.Sprintf(`COMMENT ON COLUMN "%s"."%s" IS '%s'`, tableName, field, column.Comment)
+	sql := fmt.Sprintf(`ALTER TABLE %s ADD COLUMN "%s" %s %s`, d.quoteTable(tableName), field, column.Type, strings.Join(opts, " "))
+	comment := fmt.Sprintf(`COMMENT ON COLUMN %s."%s" IS %s`, d.quoteTable(tableName), field, quoteComment(column.Comment))
 
 	return []string{sql, comment}
 }
@@ -436,26 +875,50 @@ func (d *Pgsql) alterColumn(ctx context.Context, column model.Column) []string {
 
 	var sql []string
 
-	// TODO  what if SET DEFAULT NULL?
-	// DEFAULT VALUE
+	// DEFAULT VALUE, serial 列保留序列默认值
 	if column.Default != "" {
-		sql = append(sql, fmt.Sprintf(`ALTER TABLE "%s" ALTER COLUMN "%s" SET DEFAULT %s`, tableName, field, column.Default))
+		sql = append(sql, fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN "%s" SET DEFAULT %s`, d.quoteTable(tableName), field, column.Default))
+	} else if !autoIncrement(column) {
+		sql = append(sql, fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN "%s" DROP DEFAULT`, d.quoteTable(tableName), field))
 	}
 
-	// TODO what if DROP NOT NULL?
 	// NOT NULL
-	if strings.ToUpper(column.NotNull) == "NOT NULL" {
-		sql = append(sql, fmt.Sprintf(`ALTER TABLE "%s" ALTER COLUMN "%s" SET NOT NULL`, tableName, field))
+	switch strings.ToUpper(column.NotNull) {
+	case "NOT NULL":
+		sql = append(sql, fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN "%s" SET NOT NULL`, d.quoteTable(tableName), field))
+	case "NULL":
+		sql = append(sql, fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN "%s" DROP NOT NULL`, d.quoteTable(tableName), field))
 	}
 
 	//_type := d.GetSqlType(ctx, column.Type, column.Size)
-	alterType := fmt.Sprintf(`ALTER TABLE "%s" ALTER COLUMN "%s" TYPE %s`, tableName, field, column.Type)
+	alterType := fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN "%s" TYPE %s`, d.quoteTable(tableName), field, column.Type)
 	sql = append(sql, alterType)
 
 	return sql
 
 }
 
+// autoIncrement 代码中标记 AUTO_INCREMENT 或数据库中为 serial 的列
+func autoIncrement(column model.Column) bool {
+	if column.EXTRA == "auto_increment" {
+		return true
+	}
+	for k := range column.DDLTag {
+		if strings.ToUpper(k) == "AUTO_INCREMENT" {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Pgsql) renameColumn(rename model.ColumnRename) []string {
+	return []string{fmt.Sprintf(`ALTER TABLE %s RENAME COLUMN "%s" TO "%s"`, d.quoteTable(rename.TableName), rename.From, rename.Column.Field)}
+}
+
+func (d *Pgsql) dropColumn(column model.Column) []string {
+	return []string{fmt.Sprintf(`ALTER TABLE %s DROP COLUMN "%s"`, d.quoteTable(column.TableName), column.Field)}
+}
+
 func (d *Pgsql) addIndex2(index model.Index) []string {
 	return d.addIndex(index.TableName, index)
 }
@@ -471,6 +934,71 @@ func (d *Pgsql) addIndex(table string, index model.Index) []string {
 		columns = append(columns, fmt.Sprintf("%s", column))
 	}
 
-	sql := fmt.Sprintf(`CREATE %s INDEX "%s" ON "%s" (%s)`, kind, index.Name, table, strings.Join(columns, ", "))
+	sql := fmt.Sprintf(`CREATE %s INDEX "%s" ON %s (%s)`, kind, index.Name, d.quoteTable(table), strings.Join(columns, ", "))
 	return []string{sql}
 }
+
+func (d *Pgsql) dropIndex(index model.Index) []string {
+	return []string{fmt.Sprintf(`DROP INDEX %s`, d.quoteIndex(index.TableName, index.Name))}
+}
+
+// addIndexConcurrently 不阻塞写入, 失败时留下 indisvalid=false 的索引, 由 Down 清理或下次同步时重建
+func (d *Pgsql) addIndexConcurrently(index model.Index) []string {
+	sql := d.addIndex(index.TableName, index)[0]
+	return []string{strings.Replace(sql, "INDEX", "INDEX CONCURRENTLY", 1)}
+}
+
+// replaceIndexConcurrently 以临时名称并发创建索引后替换同名索引, 替换前原索引一直可用,
+// 先清理上次失败留下的临时索引. 回滚时按原定义再次替换
+func (d *Pgsql) replaceIndexConcurrently(index model.Index) []string {
+	temp := tempIndex(index)
+	return []string{
+		d.dropTempIndex(index)[0],
+		d.addIndexConcurrently(temp)[0],
+		fmt.Sprintf(`DROP INDEX CONCURRENTLY IF EXISTS %s`, d.quoteIndex(index.TableName, index.Name)),
+		fmt.Sprintf(`ALTER INDEX %s RENAME TO "%s"`, d.quoteIndex(temp.TableName, temp.Name), index.Name),
+	}
+}
+
+// dropTempIndex 替换失败时只删除临时索引, 原索引保持不变
+func (d *Pgsql) dropTempIndex(index model.Index) []string {
+	temp := tempIndex(index)
+	return []string{fmt.Sprintf(`DROP INDEX CONCURRENTLY IF EXISTS %s`, d.quoteIndex(temp.TableName, temp.Name))}
+}
+
+func tempIndex(index model.Index) model.Index {
+	index.Name += "__new"
+	return index
+}
+
+func hasIndex(list []model.Index, index model.Index) bool {
+	for _, item := range list {
+		if item.TableName == index.TableName && item.Name == index.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// dropIndexIfExists 创建失败时索引可能不存在
+func (d *Pgsql) dropIndexIfExists(index model.Index) []string {
+	return []string{fmt.Sprintf(`DROP INDEX IF EXISTS %s`, d.quoteIndex(index.TableName, index.Name))}
+}
+
+func (d *Pgsql) addForeignKey(fk model.ForeignKey) []string {
+	sql := fmt.Sprintf(`ALTER TABLE %s ADD CONSTRAINT "%s" FOREIGN KEY ("%s") REFERENCES %s ("%s") ON DELETE %s ON UPDATE %s`,
+		d.quoteTable(fk.TableName), fk.Name, strings.Join(fk.Columns, `", "`), d.quoteTable(fk.RefTable), strings.Join(fk.RefColumns, `", "`), fk.OnDelete, fk.OnUpdate)
+	return []string{sql}
+}
+
+func (d *Pgsql) dropForeignKey(fk model.ForeignKey) []string {
+	return d.dropConstraint(fk.TableName, fk.Name)
+}
+
+func (d *Pgsql) addCheck(check model.Check) []string {
+	return []string{fmt.Sprintf(`ALTER TABLE %s ADD CONSTRAINT "%s" CHECK (%s)`, d.quoteTable(check.TableName), check.Name, check.Expr)}
+}
+
+func (d *Pgsql) dropConstraint(tableName string, name string) []string {
+	return []string{fmt.Sprintf(`ALTER TABLE %s DROP CONSTRAINT "%s"`, d.quoteTable(tableName), name)}
+}
@@ -3,6 +3,7 @@ package pgsql
 import (
 	"context"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/glennliao/table-sync/model"
@@ -77,10 +78,12 @@ func TestPgsql_LoadSchema(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			d := &Pgsql{
-				schema: tt.fields.schema,
+			d := &Pgsql{}
+			schemas := []string{model.PublicSchema}
+			if tt.fields.schema != "" {
+				schemas = []string{tt.fields.schema}
 			}
-			gotSchema, err := d.LoadSchema(tt.args.ctx, tt.args.db)
+			gotSchema, err := d.LoadSchemas(tt.args.ctx, tt.args.db, schemas)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("LoadSchema() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -127,9 +130,7 @@ func TestPgsql_createTable(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			d := &Pgsql{
-				schema: tt.fields.schema,
-			}
+			d := &Pgsql{}
 
 			var (
 				ctx = tt.args.ctx
@@ -203,9 +204,7 @@ func TestPgsql_alterTable(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			d := &Pgsql{
-				schema: tt.fields.schema,
-			}
+			d := &Pgsql{}
 
 			var (
 				ctx  = tt.args.ctx
@@ -1433,3 +1432,33 @@ const taskData = `
         "NoComment": false,
     },
 }`
+
+// 数据库默认值去掉类型转换后用于比较和回滚, serial 列的序列默认值修改列时保留
+func TestFormatColumnsDefault(t *testing.T) {
+	d := &Pgsql{}
+	columns := d.formatColumns([]Column{
+		{Table: "post", Field: "id", Type: "int8", Length: 8, NotNull: "t", Default: "nextval('post_id_seq'::regclass)"},
+		{Table: "post", Field: "status", Type: "varchar", Length: -1, Typmod: 20, NotNull: "t", Default: "'not published'::character varying"},
+		{Table: "post", Field: "title", Type: "varchar", Length: -1, Typmod: 36, NotNull: "f", Default: "NULL::character varying"},
+		{Table: "post", Field: "created_at", Type: "timestamp", Length: 8, NotNull: "f", Default: "CURRENT_TIMESTAMP"},
+	})["post"]
+
+	want := []string{"", "'not published'", "", "CURRENT_TIMESTAMP"}
+	for i, column := range columns {
+		if column.Default != want[i] {
+			t.Errorf("%s default: got %q, want %q", column.Field, column.Default, want[i])
+		}
+	}
+
+	for _, sql := range d.alterColumn(context.TODO(), columns[0]) {
+		if strings.Contains(sql, "DEFAULT") {
+			t.Errorf("serial column should keep its default: %s", sql)
+		}
+	}
+	if sql := d.alterColumn(context.TODO(), columns[1])[0]; sql != `ALTER TABLE "post" ALTER COLUMN "status" SET DEFAULT 'not published'` {
+		t.Errorf("down sql: %s", sql)
+	}
+	if sql := d.alterColumn(context.TODO(), columns[2])[0]; sql != `ALTER TABLE "post" ALTER COLUMN "title" DROP DEFAULT` {
+		t.Errorf("down sql: %s", sql)
+	}
+}
@@ -2,18 +2,28 @@ package sqlite
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"github.com/glennliao/table-sync/database"
 	"github.com/glennliao/table-sync/model"
 	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/errors/gerror"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/util/gconv"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 )
 
 func init() {
 	database.RegDatabase("sqlite", &Sqlite{})
 }
 
-type Sqlite struct{}
+type Sqlite struct {
+	// LockExpire 锁的失效时间, 为0时取 lockExpire, 见 Lock
+	LockExpire time.Duration
+}
 
 func (d *Sqlite) LoadSchema(ctx context.Context, db gdb.DB) (schema model.Schema, err error) {
 
@@ -24,23 +34,34 @@ func (d *Sqlite) LoadSchema(ctx context.Context, db gdb.DB) (schema model.Schema
 
 	var tableMap = map[string]*model.Table{}
 	for i, table := range tables {
-		cols, err := d.loadColumns(ctx, db, table.Name)
+		cols, primaryKey, err := d.loadColumns(ctx, db, table.Name)
+		if err != nil {
+			return schema, err
+		}
+
+		foreignKeys, err := d.loadForeignKey(ctx, db, table.Name)
+		if err != nil {
+			return schema, err
+		}
+
+		checks, err := d.loadCheck(ctx, db, table.Name)
+		if err != nil {
+			return schema, err
+		}
+
+		indexes, err := d.loadIndex(ctx, db, table.Name)
 		if err != nil {
 			return schema, err
 		}
 
 		tables[i].Columns = cols
+		tables[i].PrimaryKey = primaryKey
+		tables[i].ForeignKeys = foreignKeys
+		tables[i].Checks = checks
+		tables[i].Index = indexes
 		tableMap[table.Name] = &tables[i]
 	}
 
-	indexs, err := loadIndex(ctx, db, "")
-	if err != nil {
-		return
-	}
-
-	for _, index := range indexs {
-		tableMap[index.TableName].Index = append(tableMap[index.TableName].Index, index)
-	}
 	schema.Tables = tableMap
 	schema.NoComment = true
 	return
@@ -78,41 +99,282 @@ func (d *Sqlite) GetSqlType(ctx context.Context, goType string, size string) str
 	return goType
 }
 
-func (d *Sqlite) GetSyncSql(ctx context.Context, db gdb.DB, task model.SyncTask) (list []string, err error) {
+func (d *Sqlite) GetGoType(ctx context.Context, sqlType string) (string, string) {
+	name, size := database.SplitSqlType(sqlType)
+	switch name {
+	case "integer", "int", "bigint":
+		return "int64", ""
+	case "varchar":
+		return "string", size
+	case "datetime", "timestamp", "date":
+		return "time.Time", ""
+	case "real", "double", "float":
+		return "float64", ""
+	case "blob":
+		return "[]byte", ""
+	}
+	return "string", ""
+}
+
+func (d *Sqlite) GetSyncSql(ctx context.Context, db gdb.DB, task model.SyncTask) (list []model.SyncSql, err error) {
+
+	var tableFrom = map[string]string{}
+	for _, rename := range task.RenameTable {
+		tableFrom[rename.To] = rename.From
+		var indexes []model.Index
+		if dbTable := task.SchemaInDB.Tables[rename.From]; dbTable != nil {
+			for _, index := range dbTable.Index {
+				// 非本工具创建的索引不带原表名前缀, 随表重命名, 保持原名
+				if ownedIndex(rename.From, index) {
+					index.DBName = ""
+					indexes = append(indexes, index)
+				}
+			}
+		}
+		list = append(list, model.SyncSql{Table: rename.To, Kind: model.KindRenameTable,
+			Sql:  append(renameTable(rename), renameIndex(rename.From, rename.To, indexes)...),
+			Down: append(renameTable(model.TableRename{From: rename.To, To: rename.From}), renameIndex(rename.To, rename.From, indexes)...)})
+	}
 
 	for _, table := range task.CreateTable {
-		list = append(list, createTable(table)...)
+		list = append(list, model.SyncSql{Table: table.Name, Kind: model.KindCreateTable, Sql: createTable(table), Down: dropTable(table.Name)})
+	}
+
+	// 修改/删除/重命名列需要重建表
+	var rebuildTables []string
+	var rebuildTableMap = map[string]struct{}{}
+	rebuild := func(tableName string) {
+		if _, exists := rebuildTableMap[tableName]; !exists {
+			rebuildTableMap[tableName] = struct{}{}
+			rebuildTables = append(rebuildTables, tableName)
+		}
+	}
+
+	for _, col := range append(task.AlterColumn, task.DropColumn...) {
+		rebuild(col.TableName)
+	}
+
+	for _, alter := range task.AlterTable {
+		if alter.PrimaryKey {
+			rebuild(alter.Table.Name)
+		}
+	}
+
+	// 外键/CHECK约束只能在建表时声明
+	for _, fk := range append(task.AddForeignKey, task.DropForeignKey...) {
+		rebuild(fk.TableName)
+	}
+	for _, check := range append(task.AddCheck, task.DropCheck...) {
+		rebuild(check.TableName)
+	}
+
+	// columnTo 为 columnFrom 的反向映射, 用于重建回原结构
+	var columnFrom, columnTo = map[string]map[string]string{}, map[string]map[string]string{}
+	for _, rename := range task.RenameColumn {
+		if columnFrom[rename.TableName] == nil {
+			columnFrom[rename.TableName] = map[string]string{}
+			columnTo[rename.TableName] = map[string]string{}
+		}
+		columnFrom[rename.TableName][rename.Column.Field] = rename.From
+		columnTo[rename.TableName][rename.From] = rename.Column.Field
+		rebuild(rename.TableName)
 	}
 
 	for _, col := range task.AddColumn {
-		list = append(list, addColumn(col.TableName, col)...)
+		if _, exists := rebuildTableMap[col.TableName]; exists {
+			continue
+		}
+		list = append(list, model.SyncSql{Table: col.TableName, Kind: model.KindAddColumn, Name: col.Field, Sql: addColumn(col.TableName, col), Down: dropColumn(col.TableName, col)})
+	}
+
+	var droppedIndex = map[string]map[string]struct{}{}
+	for _, index := range task.DropIndex {
+		if droppedIndex[index.TableName] == nil {
+			droppedIndex[index.TableName] = map[string]struct{}{}
+		}
+		droppedIndex[index.TableName][index.Name] = struct{}{}
 	}
 
-	var alterTable = map[string]struct{}{}
+	for _, tableName := range rebuildTables {
+		from := tableName
+		if v, renamed := tableFrom[tableName]; renamed {
+			from = v
+		}
+		table, dbTable := task.SchemaInCode.Tables[tableName], task.SchemaInDB.Tables[from]
+		if table == nil || dbTable == nil {
+			continue
+		}
+
+		// 按数据库中的原结构重建, 此时表已是新名称
+		downTable := *dbTable
+		downTable.Name = tableName
+
+		sqlList := rebuildTable(table, dbTable, columnFrom[tableName])
+		for _, index := range foreignIndexes(table, dbTable, columnTo[tableName], droppedIndex[tableName]) {
+			sqlList = append(sqlList, addIndex(tableName, index)...)
+		}
 
-	for _, col := range task.AlterColumn {
-		alterTable[col.TableName] = struct{}{}
+		list = append(list, model.SyncSql{Table: tableName, Kind: model.KindRebuildTable,
+			Sql:  sqlList,
+			Down: rebuildTable(&downTable, table, columnTo[tableName])})
 	}
 
-	for tableName, _ := range alterTable {
-		for _, table := range task.SchemaInCode.Tables {
-			if table.Name == tableName {
-				sqlList, err := alterColumn(ctx, db, table)
-				if err != nil {
-					return nil, err
-				}
-				list = append(list, sqlList...)
-				break
+	// 重建的表已按代码中的结构重建索引
+	for _, index := range task.DropIndex {
+		// 重命名的表中本工具创建的索引已按新表名重建
+		if from, renamed := tableFrom[index.TableName]; renamed && ownedIndex(from, index) {
+			index.DBName = ""
+		}
+		if _, exists := rebuildTableMap[index.TableName]; !exists {
+			list = append(list, model.SyncSql{Table: index.TableName, Kind: model.KindDropIndex, Name: index.Name, Sql: dropIndex(index.TableName, index), Down: addIndex(index.TableName, index)})
+		}
+	}
+	for _, index := range task.AddIndex {
+		if _, exists := rebuildTableMap[index.TableName]; !exists {
+			list = append(list, model.SyncSql{Table: index.TableName, Kind: model.KindAddIndex, Name: index.Name, Sql: addIndex(index.TableName, index), Down: dropIndex(index.TableName, index)})
+		}
+	}
+
+	return
+}
+
+// ExecTx 按 sqlite 修改表结构的步骤执行: 开启外键约束时 DROP TABLE 会触发子表的 ON DELETE 动作,
+// 而 PRAGMA foreign_keys 在事务中无效, 因此固定一个连接, 在事务外关闭外键约束,
+// 提交前用 PRAGMA foreign_key_check 检查外键, 结束后恢复
+func (d *Sqlite) ExecTx(ctx context.Context, db gdb.DB, sqlList []string) (err error) {
+	master, err := db.GetCore().Master()
+	if err != nil {
+		return err
+	}
+	conn, err := master.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var foreignKeys bool
+	if err = conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+		return err
+	}
+	if foreignKeys {
+		if _, err = conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+			return err
+		}
+		defer func() {
+			if _, e := conn.ExecContext(ctx, "PRAGMA foreign_keys = ON"); e != nil && err == nil {
+				err = e
 			}
+		}()
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, sql := range sqlList {
+		g.Log().Info(ctx, "[tablesync]", sql)
+		if _, err = tx.ExecContext(ctx, sql); err != nil {
+			g.Log().Warning(ctx, err)
+			_ = tx.Rollback()
+			return err
 		}
 	}
 
-	//
-	//for _, index := range task.AddIndex {
-	//	list = append(list, addIndex(index.TableName, index)...)
-	//}
+	if foreignKeys {
+		if err = foreignKeyCheck(ctx, tx); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
 
-	return
+// foreignKeyCheck 重建后存在不满足外键约束的行时返回错误
+func foreignKeyCheck(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var violations []string
+	for rows.Next() {
+		var table, parent string
+		var rowid sql.NullInt64
+		var fkid int
+		if err = rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			return err
+		}
+		violations = append(violations, fmt.Sprintf("%s(rowid %d) references %s", table, rowid.Int64, parent))
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return gerror.Newf("foreign key check failed, nothing is executed:\n  %s", strings.Join(violations, "\n  "))
+	}
+	return nil
+}
+
+const lockTableName = "tablesync_lock"
+
+// lockExpire 持有锁的实例异常退出后, 超过该时间未刷新的锁视为失效
+const lockExpire = 10 * time.Minute
+
+// Lock sqlite 没有会话级的命名锁, 通过锁表的主键冲突实现互斥;
+// 持有期间每 1/3 失效时间刷新 locked_at, 执行时间较长时锁不会被其他实例视为失效
+func (d *Sqlite) Lock(ctx context.Context, db gdb.DB, name string, timeout time.Duration) (func(ctx context.Context) error, error) {
+	expire := d.LockExpire
+	if expire <= 0 {
+		expire = lockExpire
+	}
+
+	_, err := db.Exec(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` (`name` varchar(64) PRIMARY KEY NOT NULL, `locked_at` INTEGER NOT NULL)", lockTableName))
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.WaitLock(ctx, name, timeout, func() (bool, error) {
+		now := time.Now()
+		_, err := db.Exec(ctx, fmt.Sprintf("DELETE FROM `%s` WHERE `name` = ? AND `locked_at` < ?", lockTableName), name, now.Add(-expire).Unix())
+		if err != nil {
+			return false, err
+		}
+		result, err := db.Exec(ctx, fmt.Sprintf("INSERT OR IGNORE INTO `%s` (`name`, `locked_at`) VALUES (?, ?)", lockTableName), name, now.Unix())
+		if err != nil {
+			return false, err
+		}
+		n, err := result.RowsAffected()
+		return n == 1, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(expire / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				_, err := db.Exec(context.WithoutCancel(ctx), fmt.Sprintf("UPDATE `%s` SET `locked_at` = ? WHERE `name` = ?", lockTableName), time.Now().Unix(), name)
+				if err != nil {
+					g.Log().Warningf(ctx, "refresh lock %s: %v", name, err)
+				}
+			}
+		}
+	}()
+
+	return func(ctx context.Context) error {
+		close(stop)
+		<-stopped
+		_, err := db.Exec(ctx, fmt.Sprintf("DELETE FROM `%s` WHERE `name` = ?", lockTableName), name)
+		return err
+	}, nil
 }
 
 func (d *Sqlite) loadTables(ctx context.Context, db gdb.DB) (list []model.Table, err error) {
@@ -121,7 +383,7 @@ func (d *Sqlite) loadTables(ctx context.Context, db gdb.DB) (list []model.Table,
 	return
 }
 
-func (d *Sqlite) loadColumns(ctx context.Context, db gdb.DB, tableName string) (list []model.Column, err error) {
+func (d *Sqlite) loadColumns(ctx context.Context, db gdb.DB, tableName string) (list []model.Column, primaryKey []string, err error) {
 	sql := fmt.Sprintf("PRAGMA table_info('%s')", tableName)
 
 	type SqliteCol struct {
@@ -136,6 +398,9 @@ func (d *Sqlite) loadColumns(ctx context.Context, db gdb.DB, tableName string) (
 
 	err = db.GetScan(ctx, &sqliteColList, sql)
 
+	// pk 为列在主键中的序号, 从1开始
+	var pkMap = map[int]string{}
+
 	for _, col := range sqliteColList {
 
 		column := model.Column{
@@ -143,14 +408,15 @@ func (d *Sqlite) loadColumns(ctx context.Context, db gdb.DB, tableName string) (
 			Type:    col.Type,
 			Kind:    "",
 			Comment: "",
-			Default: strings.Trim(col.DfltValue, "'"),
+			Default: col.DfltValue, // 保留引号, 用于生成回滚SQL
 			NotNull: col.Notnull,
 			EXTRA:   "",
 			Size:    "",
 		}
 
-		if col.Pk == "1" {
+		if n := gconv.Int(col.Pk); n > 0 {
 			column.PrimaryKey = true
+			pkMap[n] = col.Name
 		}
 
 		if col.Notnull == "0" {
@@ -161,29 +427,128 @@ func (d *Sqlite) loadColumns(ctx context.Context, db gdb.DB, tableName string) (
 
 		list = append(list, column)
 	}
+
+	for i := 1; i <= len(pkMap); i++ {
+		primaryKey = append(primaryKey, pkMap[i])
+	}
 	return
 }
 
-func loadIndex(ctx context.Context, db gdb.DB, schemaName string) (list []model.Index, err error) {
-	sql := "SELECT * FROM sqlite_master WHERE type = 'index'"
+// loadForeignKey sqlite 不保存外键约束名, 按 fk_表名_列名 命名
+func (d *Sqlite) loadForeignKey(ctx context.Context, db gdb.DB, tableName string) (list []model.ForeignKey, err error) {
+	sql := fmt.Sprintf("PRAGMA foreign_key_list('%s')", tableName)
+
+	type SqliteForeignKey struct {
+		Id       int
+		Seq      int
+		Table    string
+		From     string
+		To       string
+		OnUpdate string
+		OnDelete string
+	}
 
-	type SqliteIndex struct {
-		Name    string
-		TblName string
-		Sql     string
+	var sqliteFkList []SqliteForeignKey
+
+	err = db.GetScan(ctx, &sqliteFkList, sql)
+	if err != nil {
+		return
 	}
 
-	var sqliteIndexList []SqliteIndex
+	var fkMap = map[int]*model.ForeignKey{}
+	var ids []int
+	for _, fk := range sqliteFkList {
+		if fkMap[fk.Id] == nil {
+			fkMap[fk.Id] = &model.ForeignKey{
+				TableName: tableName,
+				RefTable:  fk.Table,
+				OnDelete:  fk.OnDelete,
+				OnUpdate:  fk.OnUpdate,
+			}
+			ids = append(ids, fk.Id)
+		}
+		fkMap[fk.Id].Columns = append(fkMap[fk.Id].Columns, fk.From)
+		fkMap[fk.Id].RefColumns = append(fkMap[fk.Id].RefColumns, fk.To)
+	}
+
+	for _, id := range ids {
+		fk := fkMap[id]
+		fk.Name = "fk_" + tableName + "_" + strings.Join(fk.Columns, "_")
+		list = append(list, *fk)
+	}
+	return
+}
+
+var checkRegex = regexp.MustCompile("(?i)CONSTRAINT\\s+[`\"]?(\\w+)[`\"]?\\s+CHECK\\s*\\(")
+
+// loadCheck 从建表语句中解析具名的 CHECK 约束
+func (d *Sqlite) loadCheck(ctx context.Context, db gdb.DB, tableName string) (list []model.Check, err error) {
+	createSql, err := db.GetValue(ctx, "SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", tableName)
+	if err != nil {
+		return
+	}
+
+	sql := createSql.String()
+	for _, match := range checkRegex.FindAllStringSubmatchIndex(sql, -1) {
+		// 匹配到 CHECK ( 之后按括号层级找到表达式结尾
+		start, depth := match[1], 1
+		end := start
+		for ; end < len(sql) && depth > 0; end++ {
+			switch sql[end] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+		}
+		if depth != 0 {
+			continue
+		}
+		list = append(list, model.Check{
+			Name:      sql[match[2]:match[3]],
+			TableName: tableName,
+			Expr:      sql[start : end-1],
+		})
+	}
+	return
+}
 
-	err = db.GetScan(ctx, &sqliteIndexList, sql, schemaName)
+// loadIndex 主键/唯一约束自动创建的索引(origin 为 pk/u)随表维护, 无法单独删除, 不加载
+func (d *Sqlite) loadIndex(ctx context.Context, db gdb.DB, tableName string) (list []model.Index, err error) {
+	var indexList []struct {
+		Name   string
+		Unique bool
+		Origin string
+	}
+	err = db.GetScan(ctx, &indexList, fmt.Sprintf("PRAGMA index_list('%s')", tableName))
+	if err != nil {
+		return
+	}
 
-	for _, ind := range sqliteIndexList {
-		index := model.Index{}
-		index.Name = ind.Name
-		index.TableName = ind.TblName
-		index.Unique = strings.HasPrefix(ind.Sql, "CREATE UNIQUE")
+	for _, ind := range indexList {
+		if ind.Origin != "c" {
+			continue
+		}
+		// 索引名全库唯一, 本工具按 表名_索引名 创建, 去掉前缀后与代码中的索引名一致
+		index := model.Index{
+			Name:      strings.TrimPrefix(ind.Name, tableName+"_"),
+			TableName: tableName,
+			Unique:    ind.Unique,
+			DBName:    ind.Name,
+		}
 
-		index.Columns = strings.Split(ind.TblName, ",")
+		var columns []struct {
+			Seqno int
+			Name  string
+		}
+		err = db.GetScan(ctx, &columns, fmt.Sprintf("PRAGMA index_info('%s')", ind.Name))
+		if err != nil {
+			return
+		}
+		sort.Slice(columns, func(i, j int) bool { return columns[i].Seqno < columns[j].Seqno })
+		for _, column := range columns {
+			index.Columns = append(index.Columns, column.Name)
+		}
 		list = append(list, index)
 	}
 
@@ -194,9 +559,13 @@ func createTable(table model.Table) []string {
 
 	var colSqlList []string
 
+	// 仅单列整数主键可自增, 其余主键使用表级约束
+	autoIncrement := len(table.PrimaryKey) == 1
+
 	for _, column := range table.Columns {
-		if column.PrimaryKey {
+		if column.PrimaryKey && autoIncrement && strings.EqualFold(column.Type, "INTEGER") {
 			colSqlList = append(colSqlList, fmt.Sprintf("\t`%s` %s PRIMARY KEY AUTOINCREMENT NOT NULL ", column.Field, column.Type))
+			autoIncrement = false
 		} else {
 
 			opt := ""
@@ -213,84 +582,170 @@ func createTable(table model.Table) []string {
 		}
 	}
 
-	createSql := fmt.Sprintf("CREATE TABLE `%s` (\n%s\n )", table.Name, strings.Join(colSqlList, ",\n"))
+	if autoIncrement || len(table.PrimaryKey) > 1 {
+		colSqlList = append(colSqlList, fmt.Sprintf("\tPRIMARY KEY (%s)", quoteColumns(table.PrimaryKey)))
+	}
 
-	var sqlList = []string{createSql}
+	for _, fk := range table.ForeignKeys {
+		colSqlList = append(colSqlList, fmt.Sprintf("\tCONSTRAINT `%s` FOREIGN KEY (%s) REFERENCES `%s` (%s) ON DELETE %s ON UPDATE %s",
+			fk.Name, quoteColumns(fk.Columns), fk.RefTable, quoteColumns(fk.RefColumns), fk.OnDelete, fk.OnUpdate))
+	}
 
-	if len(table.Index) > 0 {
-		for _, index := range table.Index {
-			indexSql := ""
-			if index.Unique {
-				indexSql += "CREATE UNIQUE INDEX"
-			} else {
-				indexSql += "CREATE INDEX"
-			}
-			indexSql += " " + table.Name + "_" + index.Name + " on " + table.Name + " ("
+	for _, check := range table.Checks {
+		colSqlList = append(colSqlList, fmt.Sprintf("\tCONSTRAINT `%s` CHECK (%s)", check.Name, check.Expr))
+	}
 
-			for i, column := range index.Columns {
-				index.Columns[i] = "`" + column + "`"
-			}
+	createSql := fmt.Sprintf("CREATE TABLE `%s` (\n%s\n )", table.Name, strings.Join(colSqlList, ",\n"))
 
-			indexSql += strings.Join(index.Columns, ",")
-			indexSql += ")"
-			sqlList = append(sqlList, indexSql)
-		}
+	var sqlList = []string{createSql}
+
+	for _, index := range table.Index {
+		sqlList = append(sqlList, addIndex(table.Name, index)...)
 	}
 
 	return sqlList
 }
 
+func dropTable(tableName string) []string {
+	return []string{fmt.Sprintf("DROP TABLE `%s`", tableName)}
+}
+
+func renameTable(rename model.TableRename) []string {
+	return []string{fmt.Sprintf("ALTER TABLE `%s` RENAME TO `%s`", rename.From, rename.To)}
+}
+
 func addColumn(tableName string, col model.Column) []string {
 
 	addColumnSql := fmt.Sprintf("alter table `%s` add `%s`  %s %s ", tableName, col.Field, col.Type, col.NotNull)
 	return []string{addColumnSql}
 }
 
-func alterColumn(ctx context.Context, db gdb.DB, table *model.Table) ([]string, error) {
+// dropColumn 需要 sqlite 3.35.0 及以上
+func dropColumn(tableName string, col model.Column) []string {
+	return []string{fmt.Sprintf("ALTER TABLE `%s` DROP COLUMN `%s`", tableName, col.Field)}
+}
+
+// rebuildTable 按代码中的结构重建表, 并迁移两者共有列的数据, columnFrom 为重命名列的 新列名 => 原列名
+// 先建新表再删除旧表, 避免 RENAME 旧表时其他表的外键引用被改写到临时表
+func rebuildTable(table *model.Table, dbTable *model.Table, columnFrom map[string]string) []string {
 	var sqlList []string
-	tableName, tempTableName := table.Name, table.Name+"__temp_remove"
-	renameSql := fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", tableName, tempTableName)
-	sqlList = append(sqlList, renameSql)
+	tableName, tempTableName := table.Name, table.Name+"__temp_new"
 
-	indexList, err := loadIndex(ctx, db, tableName)
-	if err != nil {
-		return nil, err
+	tempTable := *table
+	tempTable.Name = tempTableName
+	tempTable.Index = nil
+	sqlList = append(sqlList, createTable(tempTable)...)
+
+	var dbColumnMap = map[string]struct{}{}
+	for _, column := range dbTable.Columns {
+		dbColumnMap[column.Field] = struct{}{}
 	}
-	for _, index := range indexList {
-		if index.TableName == tableName {
-			sqlList = append(sqlList, fmt.Sprintf("DROP INDEX %s", index.Name))
+
+	var columns, fromColumns []string
+	for _, column := range table.Columns {
+		from := column.Field
+		if v, renamed := columnFrom[column.Field]; renamed {
+			from = v
+		}
+		if _, exists := dbColumnMap[from]; exists {
+			columns = append(columns, column.Field)
+			fromColumns = append(fromColumns, from)
 		}
 	}
 
-	sqlList = append(sqlList, createTable(*table)...)
-
-	// CREATE INDEX ix_name ON old_table_name(field_name);
-
-	dataSql := fmt.Sprintf("INSERT INTO %s SELECT * FROM %s;", tableName, tempTableName)
+	dataSql := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s;", tempTableName, quoteColumns(columns), quoteColumns(fromColumns), tableName)
 	sqlList = append(sqlList, dataSql)
 
-	dropSql := fmt.Sprintf("DROP TABLE %s;", tempTableName)
+	dropSql := fmt.Sprintf("DROP TABLE %s;", tableName)
 	sqlList = append(sqlList, dropSql)
-	return sqlList, nil
+
+	renameSql := fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", tempTableName, tableName)
+	sqlList = append(sqlList, renameSql)
+
+	// 索引随旧表删除, 重命名后按新表名重建
+	sqlList = append(sqlList, createTable(*table)[1:]...)
+	return sqlList
 }
 
-func addIndex(tableName string, index model.Index) []string {
+// foreignIndexes 数据库中非本工具创建且代码中未声明的索引(手动或其他工具创建), 重建表时随旧表删除, 需按原名重建.
+// 待删除的(AllowDropIndex)及引用的列已不存在的除外, columnTo 为重命名列的 原列名 => 新列名
+func foreignIndexes(table *model.Table, dbTable *model.Table, columnTo map[string]string, drop map[string]struct{}) (list []model.Index) {
+	var codeIndex, columns = map[string]struct{}{}, map[string]struct{}{}
+	for _, index := range table.Index {
+		codeIndex[index.Name] = struct{}{}
+	}
+	for _, column := range table.Columns {
+		columns[column.Field] = struct{}{}
+	}
 
-	sql := fmt.Sprintf("ALTER  TABLE  `%s`  ADD ", tableName)
+	for _, index := range dbTable.Index {
+		if ownedIndex(dbTable.Name, index) {
+			continue
+		}
+		if _, exists := codeIndex[index.Name]; exists {
+			continue
+		}
+		if _, exists := drop[index.Name]; exists {
+			continue
+		}
+		var indexColumns []string
+		for _, column := range index.Columns {
+			if to, renamed := columnTo[column]; renamed {
+				column = to
+			}
+			if _, exists := columns[column]; !exists {
+				indexColumns = nil
+				break
+			}
+			indexColumns = append(indexColumns, column)
+		}
+		if len(indexColumns) == 0 {
+			continue
+		}
+		index.Columns = indexColumns
+		list = append(list, index)
+	}
+	return
+}
 
-	if index.Unique {
-		sql += " UNIQUE key "
-	} else {
-		sql += "index "
+// indexName 索引名全库唯一, 加表名前缀; 数据库中读取的索引使用原索引名
+func indexName(tableName string, index model.Index) string {
+	if index.DBName != "" {
+		return index.DBName
 	}
-	sql += " " + index.Name + " ("
+	return tableName + "_" + index.Name
+}
 
-	for i, column := range index.Columns {
-		index.Columns[i] = "`" + column + "`"
+func addIndex(tableName string, index model.Index) []string {
+	kind := "INDEX"
+	if index.Unique {
+		kind = "UNIQUE INDEX"
 	}
+	return []string{fmt.Sprintf("CREATE %s `%s` ON `%s` (%s)", kind, indexName(tableName, index), tableName, quoteColumns(index.Columns))}
+}
+
+func dropIndex(tableName string, index model.Index) []string {
+	return []string{fmt.Sprintf("DROP INDEX `%s`", indexName(tableName, index))}
+}
 
-	sql += strings.Join(index.Columns, ",")
-	sql += ") "
+// ownedIndex 本工具按 表名_索引名 创建的索引
+func ownedIndex(tableName string, index model.Index) bool {
+	return index.DBName == "" || index.DBName == tableName+"_"+index.Name
+}
+
+// renameIndex 表重命名后索引名仍为原表名前缀, 按新表名重建
+func renameIndex(from string, to string, indexes []model.Index) (sqlList []string) {
+	for _, index := range indexes {
+		sqlList = append(sqlList, dropIndex(from, index)...)
+		sqlList = append(sqlList, addIndex(to, index)...)
+	}
+	return
+}
 
-	return []string{sql}
+func quoteColumns(columns []string) string {
+	var list []string
+	for _, column := range columns {
+		list = append(list, "`"+column+"`")
+	}
+	return strings.Join(list, ",")
 }
@@ -0,0 +1,274 @@
+package sqlite_test
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glennliao/table-sync/database/sqlite"
+	"github.com/glennliao/table-sync/model"
+	"github.com/glennliao/table-sync/tablesync"
+	_ "github.com/gogf/gf/contrib/drivers/sqlite/v2"
+	"github.com/gogf/gf/v2/database/gdb"
+)
+
+func openDB(t *testing.T, sqlList ...string) gdb.DB {
+	db, err := gdb.New(gdb.ConfigNode{Type: "sqlite", Name: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close(context.Background()) })
+	for _, sql := range sqlList {
+		if _, err = db.Exec(context.Background(), sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func indexNames(t *testing.T, db gdb.DB, table string) string {
+	result, err := db.GetArray(context.Background(), "SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = ?", table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, name := range result {
+		names = append(names, name.String())
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// 唯一性取自 index_list, 不依赖建索引SQL的写法; 约束自动创建的索引不加载
+func TestLoadIndex(t *testing.T) {
+	db := openDB(t,
+		"CREATE TABLE post (id INTEGER PRIMARY KEY, slug varchar(32) UNIQUE, title varchar(32), user_id INTEGER)",
+		"create unique index post_uk_title on post (title, user_id)",
+		"CREATE INDEX idx_user ON post (user_id)",
+	)
+
+	schema, err := (&sqlite.Sqlite{}).LoadSchema(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexes := schema.Tables["post"].Index
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].Name < indexes[j].Name })
+
+	want := []model.Index{
+		{Name: "idx_user", TableName: "post", Columns: []string{"user_id"}, DBName: "idx_user"},
+		{Name: "uk_title", TableName: "post", Columns: []string{"title", "user_id"}, Unique: true, DBName: "post_uk_title"},
+	}
+	if len(indexes) != len(want) {
+		t.Fatalf("got %v, want %v", indexes, want)
+	}
+	for i := range want {
+		got := indexes[i]
+		if got.Name != want[i].Name || got.DBName != want[i].DBName || got.Unique != want[i].Unique || strings.Join(got.Columns, ",") != strings.Join(want[i].Columns, ",") {
+			t.Errorf("got %+v, want %+v", got, want[i])
+		}
+	}
+}
+
+type article struct {
+	tablesync.TableMeta `tableName:"article" previousNames:"post"`
+	Id                  int64  `ddl:"primaryKey"`
+	Title               string `ddl:"size:32;index:title"`
+	UserId              int64
+}
+
+// 表重命名时只重建带原表名前缀的索引, 外部创建的索引保持原名, 回滚后恢复
+func TestRenameTableIndex(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t,
+		"CREATE TABLE post (id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL, title varchar(32), user_id INTEGER)",
+		"CREATE INDEX post_idx_title ON post (title)",
+		"CREATE INDEX idx_user ON post (user_id)",
+	)
+
+	syncer := &tablesync.Syncer{Tables: []tablesync.Table{article{}}}
+	plan, err := syncer.Plan(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = syncer.Sync(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if got := indexNames(t, db, "article"); got != "article_idx_title,idx_user" {
+		t.Errorf("indexes after rename: %s", got)
+	}
+	if next, err := syncer.Plan(ctx, db); err != nil || !next.Empty() {
+		t.Errorf("plan should be empty after sync, got: %v %s", err, next)
+	}
+
+	if err = syncer.Rollback(ctx, db, plan); err != nil {
+		t.Fatal(err)
+	}
+	if got := indexNames(t, db, "post"); got != "idx_user,post_idx_title" {
+		t.Errorf("indexes after rollback: %s", got)
+	}
+}
+
+// 锁被持有时等待超时失败, 释放后可再次获取, 不同名称互不影响
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	driver := &sqlite.Sqlite{}
+
+	release, err := driver.Lock(ctx, db, "tablesync", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = driver.Lock(ctx, db, "tablesync", 200*time.Millisecond); err == nil {
+		t.Fatal("lock should time out while held")
+	}
+	other, err := driver.Lock(ctx, db, "other", 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("lock with another name: %v", err)
+	}
+	if err = other(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	release, err = driver.Lock(ctx, db, "tablesync", 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("lock after release: %v", err)
+	}
+	if err = release(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 持有期间刷新 locked_at, 超过失效时间后其他实例仍不能获取
+func TestLockRefresh(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	driver := &sqlite.Sqlite{LockExpire: 2 * time.Second}
+
+	release, err := driver.Lock(ctx, db, "tablesync", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(3 * time.Second)
+	if _, err = driver.Lock(ctx, db, "tablesync", 200*time.Millisecond); err == nil {
+		t.Fatal("held lock should be refreshed and not expire")
+	}
+	if err = release(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type commentV1 struct {
+	tablesync.TableMeta `tableName:"comment"`
+	Id                  int64  `ddl:"primaryKey"`
+	Body                string `ddl:"size:64;index:body"`
+	UserId              int64
+}
+
+type commentV2 struct {
+	tablesync.TableMeta `tableName:"comment"`
+	Id                  int64  `ddl:"primaryKey"`
+	Body                string `ddl:"size:128;index:body"`
+	AuthorId            int64  `ddl:"was:user_id"`
+}
+
+// 重建表时保留手动创建的索引, 列重命名后引用新列名
+func TestRebuildKeepsForeignIndex(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	if err := (&tablesync.Syncer{Tables: []tablesync.Table{commentV1{}}}).Sync(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(ctx, "CREATE INDEX idx_manual_user ON comment (user_id)"); err != nil {
+		t.Fatal(err)
+	}
+
+	syncer := &tablesync.Syncer{Tables: []tablesync.Table{commentV2{}}}
+	if err := syncer.Sync(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if got := indexNames(t, db, "comment"); got != "comment_idx_body,idx_manual_user" {
+		t.Errorf("indexes after rebuild: %s", got)
+	}
+	columns, err := db.GetArray(ctx, "SELECT name FROM pragma_index_info('idx_manual_user')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(columns) != 1 || columns[0].String() != "author_id" {
+		t.Errorf("index should follow the renamed column, got %v", columns)
+	}
+	if plan, err := syncer.Plan(ctx, db); err != nil || !plan.Empty() {
+		t.Errorf("plan should be empty after sync, got: %v %s", err, plan)
+	}
+}
+
+// 回滚重建的表时保留默认值的引号
+func TestRollbackKeepsDefault(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t, "CREATE TABLE post (id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL, title varchar(32), status varchar(16) NOT NULL DEFAULT 'not published')")
+
+	syncer := &tablesync.Syncer{Tables: []tablesync.Table{post{}}}
+	plan, err := syncer.Plan(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = syncer.Sync(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if err = syncer.Rollback(ctx, db, plan); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec(ctx, "INSERT INTO post (title) VALUES ('hello')"); err != nil {
+		t.Fatal(err)
+	}
+	status, err := db.GetValue(ctx, "SELECT status FROM post")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.String() != "not published" {
+		t.Errorf("default after rollback: %q", status.String())
+	}
+}
+
+type post struct {
+	tablesync.TableMeta `tableName:"post"`
+	Id                  int64  `ddl:"primaryKey"`
+	Title               string `ddl:"size:64"`
+	Status              string `ddl:"size:16;not null;default:'not published'"`
+}
+
+type articleIndex struct {
+	tablesync.TableMeta `tableName:"article"`
+	Id                  int64  `ddl:"primaryKey"`
+	Title               string `ddl:"size:32;index:title"`
+	UserId              int64  `ddl:"index:title"`
+}
+
+// 索引定义变更时删除后重建
+func TestChangeIndex(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t,
+		"CREATE TABLE article (id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL, title varchar(32), user_id INTEGER)",
+		"CREATE INDEX article_idx_title ON article (title)",
+	)
+
+	syncer := &tablesync.Syncer{Tables: []tablesync.Table{articleIndex{}}}
+	if err := syncer.Sync(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	columns, err := db.GetArray(ctx, "SELECT name FROM pragma_index_info('article_idx_title') ORDER BY seqno")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(columns) != 2 || columns[0].String() != "title" || columns[1].String() != "user_id" {
+		t.Errorf("index columns after sync: %v", columns)
+	}
+	if plan, err := syncer.Plan(ctx, db); err != nil || !plan.Empty() {
+		t.Errorf("plan should be empty after sync, got: %v %s", err, plan)
+	}
+}
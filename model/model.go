@@ -1,46 +1,213 @@
 package model
 
+import "strings"
+
 const DDLPrimaryKey = "primaryKey"
 const DDLUniqueIndex = "uniqueIndex"
+const DDLWas = "was" // 列重命名前的名称
+const DDLForeignKey = "fk"
+const DDLCheck = "check"
+
+// 同步操作类型, 与 SyncTask 中的字段对应
+const (
+	KindRenameTable    = "RenameTable"
+	KindCreateTable    = "CreateTable"
+	KindAlterTable     = "AlterTable"
+	KindAddColumn      = "AddColumn"
+	KindAlterColumn    = "AlterColumn"
+	KindAddIndex       = "AddIndex"
+	KindDropIndex      = "DropIndex"
+	KindDropColumn     = "DropColumn"
+	KindRenameColumn   = "RenameColumn"
+	KindAddForeignKey  = "AddForeignKey"
+	KindDropForeignKey = "DropForeignKey"
+	KindAddCheck       = "AddCheck"
+	KindDropCheck      = "DropCheck"
+
+	// KindRebuildTable 不支持直接修改列的数据库(sqlite)通过重建表完成变更
+	KindRebuildTable = "RebuildTable"
+)
+
+// mysql 在线变更策略, 为空时不指定 ALGORITHM/LOCK
+const (
+	OnlineDDLAuto    = "auto"    // 支持在线执行的变更追加 ALGORITHM/LOCK, 其余由 MySQL 自行选择
+	OnlineDDLRequire = "require" // 存在无法在线执行的变更时返回错误
+)
+
+// 同步操作对数据的影响分级
+const (
+	SafetySafe        = "safe"        // 仅修改元数据
+	SafetyBlocking    = "blocking"    // 可能锁表/重写表, 或因已有数据执行失败, 不丢失数据
+	SafetyDestructive = "destructive" // 可能丢失或改变已有数据
+)
 
 type Schema struct {
-	Tables    map[string]*Table
-	NoComment bool
+	Tables    map[string]*Table `json:"tables" yaml:"tables"`
+	NoComment bool              `json:"noComment,omitempty" yaml:"noComment,omitempty"`
 }
 
 type Table struct {
-	Name    string
-	Comment string
-	Charset string
-	Columns []Column
-	Index   []Index
+	Name           string       `json:"name" yaml:"name"`
+	Comment        string       `json:"comment,omitempty" yaml:"comment,omitempty"`
+	Charset        string       `json:"charset,omitempty" yaml:"charset,omitempty"`
+	Collation      string       `json:"collation,omitempty" yaml:"collation,omitempty"`
+	PrimaryKey     []string     `json:"primaryKey,omitempty" yaml:"primaryKey,omitempty"`         // 主键列, 按主键顺序
+	PrimaryKeyName string       `json:"primaryKeyName,omitempty" yaml:"primaryKeyName,omitempty"` // 数据库中的主键约束名(pgsql)
+	Columns        []Column     `json:"columns" yaml:"columns"`
+	Index          []Index      `json:"index,omitempty" yaml:"index,omitempty"`
+	ForeignKeys    []ForeignKey `json:"foreignKeys,omitempty" yaml:"foreignKeys,omitempty"`
+	Checks         []Check      `json:"checks,omitempty" yaml:"checks,omitempty"`
+	PreviousNames  []string     `json:"previousNames,omitempty" yaml:"previousNames,omitempty"` // 表重命名前使用过的名称
+	OnlineDDL      string       `json:"onlineDDL,omitempty" yaml:"onlineDDL,omitempty"`         // mysql 在线变更策略, OnlineDDL*
 }
 
 type Index struct {
-	Unique    bool
-	Name      string
-	Columns   []string
-	TableName string
+	Unique    bool     `json:"unique,omitempty" yaml:"unique,omitempty"`
+	Name      string   `json:"name" yaml:"name"`
+	Columns   []string `json:"columns" yaml:"columns"`
+	TableName string   `json:"tableName,omitempty" yaml:"tableName,omitempty"`
+	Invalid   bool     `json:"invalid,omitempty" yaml:"invalid,omitempty"` // 数据库中创建失败的索引(pgsql CONCURRENTLY), 需重建
+	DBName    string   `json:"dbName,omitempty" yaml:"dbName,omitempty"`   // 数据库中的索引名(sqlite), 非本工具创建的索引可能不带表名前缀
+}
+
+type ForeignKey struct {
+	Name       string   `json:"name" yaml:"name"`
+	TableName  string   `json:"tableName,omitempty" yaml:"tableName,omitempty"`
+	Columns    []string `json:"columns" yaml:"columns"`
+	RefTable   string   `json:"refTable" yaml:"refTable"`
+	RefColumns []string `json:"refColumns" yaml:"refColumns"`
+	OnDelete   string   `json:"onDelete,omitempty" yaml:"onDelete,omitempty"` // NO ACTION/RESTRICT/CASCADE/SET NULL/SET DEFAULT
+	OnUpdate   string   `json:"onUpdate,omitempty" yaml:"onUpdate,omitempty"`
+}
+
+type Check struct {
+	Name      string `json:"name" yaml:"name"`
+	TableName string `json:"tableName,omitempty" yaml:"tableName,omitempty"`
+	Expr      string `json:"expr" yaml:"expr"`
 }
 
 type Column struct {
-	Field      string `json:"field"`     // 字段名
-	Type       string `json:"type"`      // 字段类型
-	Kind       string `json:"kind" `     // 字段类型
-	Comment    string `json:"comment"`   // 字段注释
-	TableName  string `json:"tableName"` //
-	Default    string //
-	NotNull    string // not null/null
-	EXTRA      string
-	Size       string
-	PrimaryKey bool
-	DDLTag     map[string]string
+	Field      string            `json:"field" yaml:"field"`                             // 字段名
+	Type       string            `json:"type" yaml:"type"`                               // 字段类型
+	Kind       string            `json:"kind,omitempty" yaml:"kind,omitempty"`           // 字段类型
+	Comment    string            `json:"comment,omitempty" yaml:"comment,omitempty"`     // 字段注释
+	TableName  string            `json:"tableName,omitempty" yaml:"tableName,omitempty"` //
+	Default    string            `json:"default,omitempty" yaml:"default,omitempty"`     //
+	NotNull    string            `json:"notNull" yaml:"notNull"`                         // not null/null
+	EXTRA      string            `json:"extra,omitempty" yaml:"extra,omitempty"`
+	Size       string            `json:"size,omitempty" yaml:"size,omitempty"`
+	PrimaryKey bool              `json:"primaryKey,omitempty" yaml:"primaryKey,omitempty"`
+	DDLTag     map[string]string `json:"ddlTag,omitempty" yaml:"ddlTag,omitempty"`
+}
+
+// TableRename 表重命名
+type TableRename struct {
+	From string
+	To   string
+}
+
+// TableAlter 表属性变更, Table 为代码中的表定义
+type TableAlter struct {
+	Table      Table
+	Comment    bool // 表注释变更
+	Charset    bool // 字符集/排序规则变更
+	PrimaryKey bool // 主键变更
+}
+
+// ColumnRename 列重命名, Column 为重命名后的列定义
+type ColumnRename struct {
+	TableName string
+	From      string
+	Column    Column
 }
 
 type SyncTask struct {
-	CreateTable  []Table
-	AddColumn    []Column
-	AlterColumn  []Column
-	AddIndex     []Index
-	SchemaInCode Schema
+	RenameTable    []TableRename
+	CreateTable    []Table
+	AlterTable     []TableAlter
+	AddColumn      []Column
+	AlterColumn    []Column
+	AddIndex       []Index
+	DropIndex      []Index
+	AddForeignKey  []ForeignKey
+	DropForeignKey []ForeignKey
+	AddCheck       []Check
+	DropCheck      []Check
+	DropColumn     []Column
+	RenameColumn   []ColumnRename
+	SchemaInCode   Schema
+	SchemaInDB     Schema
+
+	// ConcurrentIndex 已有表上的新索引不锁表创建(pgsql CREATE INDEX CONCURRENTLY), 生成的SQL为 NoTx
+	ConcurrentIndex bool
+}
+
+// SyncSql 单个同步操作生成的SQL, 按表和操作类型划分
+type SyncSql struct {
+	Table string   // 表名
+	Kind  string   // 操作类型, Kind*
+	Name  string   // 操作对象(列名/索引名), 整表操作时为空
+	Sql   []string //
+	Down  []string // 撤销该操作的SQL, 按 LoadSchema 获取的原结构还原
+
+	Safety string // 影响分级, Safety*
+	Reason string // 非 safe 时的原因
+
+	NoTx    bool     // 不能在事务中执行, 在其余SQL的事务提交后依次执行
+	Cleanup []string // NoTx 操作执行失败时清理未完成的变更(如 pgsql 中 indisvalid=false 的索引), 不还原已有结构
+}
+
+// DBTable 返回数据库中与代码表 name 对应的表, 已考虑表重命名
+func (t SyncTask) DBTable(name string) *Table {
+	for _, rename := range t.RenameTable {
+		if rename.To == name {
+			name = rename.From
+			break
+		}
+	}
+	if t.SchemaInDB.Tables == nil {
+		return nil
+	}
+	return t.SchemaInDB.Tables[name]
+}
+
+// DBColumn 返回数据库中代码表 tableName 的列 field, 已考虑表重命名
+func (t SyncTask) DBColumn(tableName string, field string) (Column, bool) {
+	if table := t.DBTable(tableName); table != nil {
+		for _, column := range table.Columns {
+			if column.Field == field {
+				return column, true
+			}
+		}
+	}
+	return Column{}, false
+}
+
+// DBColumnName 返回代码表 tableName 的列 field 在数据库中的列名, 已考虑列重命名
+func (t SyncTask) DBColumnName(tableName string, field string) string {
+	for _, rename := range t.RenameColumn {
+		if rename.TableName == tableName && rename.Column.Field == field {
+			return rename.From
+		}
+	}
+	return field
+}
+
+// PublicSchema pgsql 默认 schema, 其中的表不带 schema 前缀
+const PublicSchema = "public"
+
+// QualifiedName schema 不为空且不是 public 时返回 schema.table
+func QualifiedName(schema string, table string) string {
+	if schema == "" || schema == PublicSchema {
+		return table
+	}
+	return schema + "." + table
+}
+
+// SplitQualifiedName 拆分 schema.table, 不带 schema 时 schema 为空
+func SplitQualifiedName(name string) (schema string, table string) {
+	if i := strings.Index(name, "."); i > 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
 }
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gogf/gf/v2/encoding/gyaml"
+	"github.com/gogf/gf/v2/errors/gerror"
+	"github.com/gogf/gf/v2/os/gfile"
+)
+
+// SnapshotVersion 快照格式版本, 格式不兼容变更时递增
+const SnapshotVersion = 1
+
+// Snapshot 表结构快照, 表/索引/外键/约束按名称排序, 列保持定义顺序, 相同结构的序列化结果一致
+type Snapshot struct {
+	Version   int     `json:"version" yaml:"version"`
+	Dialect   string  `json:"dialect,omitempty" yaml:"dialect,omitempty"` // 生成快照的数据库类型, 列类型与其相关
+	NoComment bool    `json:"noComment,omitempty" yaml:"noComment,omitempty"`
+	Tables    []Table `json:"tables" yaml:"tables"`
+}
+
+// NewSnapshot 按确定的顺序生成快照, 不修改 schema
+func NewSnapshot(schema Schema, dialect string) Snapshot {
+	snapshot := Snapshot{
+		Version:   SnapshotVersion,
+		Dialect:   dialect,
+		NoComment: schema.NoComment,
+		Tables:    []Table{},
+	}
+	for _, table := range schema.Tables {
+		t := *table
+		t.Index = append([]Index(nil), t.Index...)
+		t.ForeignKeys = append([]ForeignKey(nil), t.ForeignKeys...)
+		t.Checks = append([]Check(nil), t.Checks...)
+		sort.Slice(t.Index, func(i, j int) bool { return t.Index[i].Name < t.Index[j].Name })
+		sort.Slice(t.ForeignKeys, func(i, j int) bool { return t.ForeignKeys[i].Name < t.ForeignKeys[j].Name })
+		sort.Slice(t.Checks, func(i, j int) bool { return t.Checks[i].Name < t.Checks[j].Name })
+		snapshot.Tables = append(snapshot.Tables, t)
+	}
+	sort.Slice(snapshot.Tables, func(i, j int) bool { return snapshot.Tables[i].Name < snapshot.Tables[j].Name })
+	return snapshot
+}
+
+// Schema 快照还原为表结构
+func (s Snapshot) Schema() Schema {
+	schema := Schema{Tables: map[string]*Table{}, NoComment: s.NoComment}
+	for i := range s.Tables {
+		table := s.Tables[i]
+		schema.Tables[table.Name] = &table
+	}
+	return schema
+}
+
+// JSON 两空格缩进的 JSON, 以换行结尾
+func (s Snapshot) JSON() ([]byte, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// YAML 序列化为 YAML
+func (s Snapshot) YAML() ([]byte, error) {
+	return gyaml.Encode(s)
+}
+
+// LoadSnapshotJSON 从 JSON 加载快照
+func LoadSnapshotJSON(data []byte) (snapshot Snapshot, err error) {
+	if err = json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, gerror.Wrap(err, "decode snapshot json")
+	}
+	return snapshot, snapshot.check()
+}
+
+// LoadSnapshotYAML 从 YAML 加载快照
+func LoadSnapshotYAML(data []byte) (snapshot Snapshot, err error) {
+	if err = gyaml.DecodeTo(data, &snapshot); err != nil {
+		return
+	}
+	return snapshot, snapshot.check()
+}
+
+// LoadSnapshotFile 按扩展名(.yaml/.yml 或 .json)加载快照文件
+func LoadSnapshotFile(path string) (Snapshot, error) {
+	data := gfile.GetBytes(path)
+	if data == nil {
+		return Snapshot{}, gerror.Newf("read snapshot file %s failed", path)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return LoadSnapshotYAML(data)
+	}
+	return LoadSnapshotJSON(data)
+}
+
+func (s Snapshot) check() error {
+	if s.Version < 1 || s.Version > SnapshotVersion {
+		return gerror.Newf("unsupported snapshot version %d, current version is %d", s.Version, SnapshotVersion)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gogf/gf/v2/os/gfile"
+)
+
+func snapshotSchema() Schema {
+	return Schema{Tables: map[string]*Table{
+		"user": {
+			Name:       "user",
+			Comment:    "用户",
+			PrimaryKey: []string{"id"},
+			Columns: []Column{
+				{Field: "id", Type: "bigint", NotNull: "not null", PrimaryKey: true},
+				{Field: "name", Type: "varchar(64)", NotNull: "not null", Default: "''"},
+				{Field: "email", Type: "varchar(128)", NotNull: "null"},
+			},
+			Index: []Index{
+				{Name: "uk_name", Unique: true, Columns: []string{"name"}},
+				{Name: "idx_email", Columns: []string{"email"}},
+			},
+			Checks: []Check{{Name: "chk_user_name", Expr: "length(name) > 0"}},
+		},
+		"post": {
+			Name:        "post",
+			PrimaryKey:  []string{"id"},
+			Columns:     []Column{{Field: "id", Type: "bigint", NotNull: "not null", PrimaryKey: true}, {Field: "user_id", Type: "bigint", NotNull: "not null"}},
+			ForeignKeys: []ForeignKey{{Name: "fk_post_user", Columns: []string{"user_id"}, RefTable: "user", RefColumns: []string{"id"}, OnDelete: "CASCADE"}},
+		},
+	}}
+}
+
+// 相同结构的快照序列化结果一致, JSON/YAML 加载后还原为原结构
+func TestSnapshotRoundTrip(t *testing.T) {
+	schema := snapshotSchema()
+	snapshot := NewSnapshot(schema, "mysql")
+	if snapshot.Tables[0].Name != "post" || snapshot.Tables[1].Index[0].Name != "idx_email" {
+		t.Errorf("tables and indexes should be sorted by name, got %+v", snapshot.Tables)
+	}
+	if schema.Tables["user"].Index[0].Name != "uk_name" {
+		t.Error("NewSnapshot should not modify the schema")
+	}
+
+	data, err := snapshot.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := NewSnapshot(snapshotSchema(), "mysql").JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Error("json of the same schema should be identical")
+	}
+
+	dir := t.TempDir()
+	yamlData, err := snapshot.YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{"schema.json": data, "schema.yml": yamlData}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err = gfile.PutBytes(path, content); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadSnapshotFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if loaded.Dialect != "mysql" || !reflect.DeepEqual(loaded.Schema(), snapshot.Schema()) {
+			t.Errorf("%s: loaded schema differs:\n%+v\n%+v", name, loaded.Schema().Tables["user"], snapshot.Schema().Tables["user"])
+		}
+	}
+}
+
+func TestLoadSnapshotVersion(t *testing.T) {
+	if _, err := LoadSnapshotJSON([]byte(`{"version": 2, "tables": []}`)); err == nil {
+		t.Error("newer snapshot version should fail")
+	}
+	if _, err := LoadSnapshotYAML([]byte("tables: []\n")); err == nil {
+		t.Error("snapshot without version should fail")
+	}
+	if _, err := LoadSnapshotFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing file should fail")
+	}
+}
@@ -4,10 +4,6 @@ import (
 	"context"
 	"fmt"
 	"github.com/gogf/gf/v2/frame/g"
-	"github.com/gogf/gf/v2/os/gstructs"
-	"github.com/gogf/gf/v2/text/gstr"
-	"reflect"
-	"strings"
 )
 
 // CheckAbandonFields 检查table中该废弃的字段
@@ -15,32 +11,33 @@ func CheckAbandonFields(ctx context.Context, tables []Table) {
 
 	gDb := g.DB()
 
-	abandonFields := map[string][]string{}
+	s := &Syncer{Tables: tables}
+	if err := s.init(gDb); err != nil {
+		g.Log().Error(ctx, err)
+		return
+	}
 
-	for _, t := range tables {
-		tableName := reflect.TypeOf(t).String()
-		// 分割packName.structName
-		tableName = gstr.CaseSnake(tableName[strings.Index(tableName, ".")+1:])
+	schemaInCode, err := s.schemaInCode(tables)
+	if err != nil {
+		g.Log().Error(ctx, err)
+		return
+	}
+	schemaInDB, err := LoadSchema(ctx, gDb, codeSchemas(schemaInCode)...)
+	if err != nil {
+		g.Log().Error(ctx, err)
+		return
+	}
 
-		dbTable, err := gDb.Model().TableFields(tableName)
-		if err != nil {
-			g.Log().Error(ctx, err)
-		}
+	abandonFields := map[string][]string{}
 
-		mFields, _ := gstructs.Fields(gstructs.FieldsInput{
-			Pointer:         t,
-			RecursiveOption: gstructs.RecursiveOptionEmbedded,
-		})
-		for _, field := range mFields {
-			filedName := gstr.CaseSnake(field.Name())
-			v, ok := dbTable[filedName]
-			if ok && (filedName == v.Name) {
-				delete(dbTable, filedName)
-			}
+	for tableName, codeTable := range schemaInCode.Tables {
+		dbTable := schemaInDB.Tables[tableName]
+		if dbTable == nil {
+			continue
 		}
 
-		for _, field := range dbTable {
-			abandonFields[tableName] = append(abandonFields[tableName], field.Name)
+		for _, column := range abandonColumns(*codeTable, *dbTable) {
+			abandonFields[tableName] = append(abandonFields[tableName], column.Field)
 		}
 	}
 
@@ -2,155 +2,332 @@ package tablesync
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"strings"
 
+	"github.com/glennliao/table-sync/database"
 	"github.com/glennliao/table-sync/model"
 	"github.com/gogf/gf/v2/container/gvar"
+	"github.com/gogf/gf/v2/errors/gerror"
 	"github.com/gogf/gf/v2/os/gstructs"
 	"github.com/gogf/gf/v2/text/gstr"
+	"github.com/gogf/gf/v2/util/gconv"
 )
 
-func (s *Syncer) schemaInCode(structTableList []Table) model.Schema {
+// CodeSnapshot 代码中表结构的快照, 列类型按 dialect 对应的数据库生成
+func (s *Syncer) CodeSnapshot(dialect string) (model.Snapshot, error) {
+	driver := database.RegMap[dialect]
+	if driver == nil {
+		return model.Snapshot{}, gerror.Newf("unsupported database type: %s", dialect)
+	}
+	syncer := *s
+	syncer.DatabaseType, syncer.DatabaseDriver = dialect, driver
+	schema, err := syncer.schemaInCode(syncer.Tables)
+	if err != nil {
+		return model.Snapshot{}, err
+	}
+	return model.NewSnapshot(schema, dialect), nil
+}
+
+// tableDef 表定义, 来自结构体或结构文件
+type tableDef struct {
+	Name   string            // 表名
+	Meta   map[string]string // TableMeta 标签 comment/charset/collate/previousNames/checks/onlineDDL/schema/group
+	Fields []fieldDef
+}
+
+type fieldDef struct {
+	Column string // 列名
+	Type   string // go 类型, ddl 中的 type 优先
+	DDL    string // ddl 标签
+}
+
+// schemaInCode 结构体及结构文件中定义的表结构
+func (s *Syncer) schemaInCode(structTableList []Table) (model.Schema, error) {
 	tableMap := map[string]*model.Table{}
 
 	for _, table := range structTableList {
+		def, err := structTableDef(table)
+		if err != nil {
+			return model.Schema{}, err
+		}
+		if !s.inGroup(def) {
+			continue
+		}
+		table := s.buildTable(def)
+		tableMap[table.Name] = table
+	}
+
+	for _, path := range s.SchemaFiles {
+		defs, err := loadSchemaFile(path)
+		if err != nil {
+			return model.Schema{}, err
+		}
+		for _, def := range defs {
+			if !s.inGroup(def) {
+				continue
+			}
+			table := s.buildTable(def)
+			if _, exists := tableMap[table.Name]; exists {
+				return model.Schema{}, gerror.Newf("table %s in %s is already defined", table.Name, path)
+			}
+			tableMap[table.Name] = table
+		}
+	}
+
+	return model.Schema{
+		Tables: tableMap,
+	}, nil
+}
+
+func structTableDef(table Table) (def tableDef, err error) {
+	fields, err := fields(gstructs.FieldsInput{
+		Pointer:         table,
+		RecursiveOption: gstructs.RecursiveOptionEmbedded,
+	})
+	if err != nil {
+		return
+	}
+
+	t, err := gstructs.StructType(table)
+	if err != nil {
+		return
+	}
+
+	def.Meta = tableMeta(table)
+	def.Name = gstr.CaseSnake(t.Name())
+	if def.Meta["tableName"] != "" {
+		def.Name = def.Meta["tableName"]
+	}
 
-		fields, err := fields(gstructs.FieldsInput{
-			Pointer:         table,
-			RecursiveOption: gstructs.RecursiveOptionEmbedded,
+	for _, field := range fields {
+		def.Fields = append(def.Fields, fieldDef{
+			Column: convertCamelToUnderScore(field.Name()),
+			Type:   field.Type().String(),
+			DDL:    field.Tag("ddl"),
 		})
+	}
+	return
+}
 
-		if err != nil {
-			panic(err)
+func (s *Syncer) buildTable(def tableDef) *model.Table {
+	// 约束按不带 schema 的表名命名, 表名为 schema.table(pgsql 非 public schema)
+	tableName := def.Name
+	schema := s.tableSchema(def)
+	indexMap := map[string]*model.Index{}
+
+	var cols []model.Column
+	var primaryKeys []model.Column
+	var foreignKeys []model.ForeignKey
+	var checks []model.Check
+
+	for _, field := range def.Fields {
+
+		// column
+		col := model.Column{
+			Field: field.Column,
+			Type:  field.Type,
 		}
 
-		indexMap := map[string]*model.Index{}
+		col = parseDdlTag(col, field.DDL)
 
-		var cols []model.Column
+		if col.DDLTag[model.DDLPrimaryKey] != "" {
+			col.PrimaryKey = true
+			primaryKeys = append(primaryKeys, col)
+		}
 
-		for _, field := range fields {
+		if col.DDLTag["type"] != "" {
+			col.Type = col.DDLTag["type"]
+		}
 
-			// column
-			colType := field.Type().String()
+		if col.DDLTag["not null"] != "" || col.DDLTag[model.DDLPrimaryKey] != "" {
+			col.NotNull = "not null"
+		} else {
+			col.NotNull = "null"
+		}
 
-			col := model.Column{
-				Field: convertCamelToUnderScore(field.Name()),
-				Type:  colType,
-			}
+		if col.DDLTag["default"] != "" {
+			col.Default = col.DDLTag["default"]
+		}
 
-			col = parseDdlTag(col, field.Tag("ddl"))
+		col.Size = col.DDLTag["size"]
 
-			if col.DDLTag[model.DDLPrimaryKey] == "true" {
-				col.PrimaryKey = true
-			}
+		col.Type = s.DatabaseDriver.GetSqlType(context.Background(), col.Type, col.Size)
 
-			if col.DDLTag["type"] != "" {
-				col.Type = col.DDLTag["type"]
-			}
+		cols = append(cols, col)
 
-			if col.DDLTag["not null"] != "" || col.DDLTag[model.DDLPrimaryKey] != "" {
-				col.NotNull = "not null"
-			} else {
-				col.NotNull = "null"
-			}
+		// foreign key fk:table.column;onDelete:cascade;onUpdate:restrict
+		if ref := col.DDLTag[model.DDLForeignKey]; ref != "" {
+			foreignKeys = append(foreignKeys, parseForeignKey(col, ref))
+		}
 
-			if col.DDLTag["default"] != "" {
-				col.Default = col.DDLTag["default"]
-			}
+		// check:state in (0,1,2)
+		if expr := col.DDLTag[model.DDLCheck]; expr != "" {
+			checks = append(checks, model.Check{Name: col.Field, Expr: expr})
+		}
 
-			col.Size = col.DDLTag["size"]
-
-			col.Type = s.DatabaseDriver.GetSqlType(context.Background(), col.Type, col.Size)
-
-			cols = append(cols, col)
-
-			// index
-			colIndex := col.DDLTag["index"]
-			colUniqueIndex := col.DDLTag[model.DDLUniqueIndex]
-
-			if colIndex != "" || colUniqueIndex != "" {
-				index := &model.Index{}
-				name := ""
-				if colIndex != "" {
-					if colIndex != "true" {
-						name = "idx_" + colIndex
-					} else {
-						name = "idx_" + col.Field
-					}
-				} else if colUniqueIndex != "" {
-					index.Unique = true
-					if colUniqueIndex != "true" {
-						name = "uk_" + colUniqueIndex
-					} else {
-						name = "uk_" + col.Field
-					}
-				}
-				index.Name = name
-				if indexMap[name] != nil {
-					indexMap[name].Columns = append(indexMap[name].Columns, col.Field)
+		// index
+		colIndex := col.DDLTag["index"]
+		colUniqueIndex := col.DDLTag[model.DDLUniqueIndex]
 
+		if colIndex != "" || colUniqueIndex != "" {
+			index := &model.Index{}
+			name := ""
+			if colIndex != "" {
+				if colIndex != "true" {
+					name = "idx_" + colIndex
+				} else {
+					name = "idx_" + col.Field
+				}
+			} else if colUniqueIndex != "" {
+				index.Unique = true
+				if colUniqueIndex != "true" {
+					name = "uk_" + colUniqueIndex
 				} else {
-					index.Columns = append(index.Columns, col.Field)
-					indexMap[name] = index
+					name = "uk_" + col.Field
 				}
 			}
-		}
+			index.Name = name
+			if indexMap[name] != nil {
+				indexMap[name].Columns = append(indexMap[name].Columns, col.Field)
 
-		t, err := gstructs.StructType(table)
-		commentVal := GetTableMeta(table, "comment")
-		charsetVal := GetTableMeta(table, "charset")
-		tableNameVal := GetTableMeta(table, "tableName")
-		charset := charsetVal.String()
-		if charset == "" {
-			charset = "utf8mb4"
+			} else {
+				index.Columns = append(index.Columns, col.Field)
+				indexMap[name] = index
+			}
 		}
+	}
 
-		tableName := gstr.CaseSnake(t.Name())
-		if tableNameVal.String() != "" {
-			tableName = tableNameVal.String()
+	// 联合主键顺序 primaryKey:1 primaryKey:2, 未指定顺序时按字段顺序
+	sort.SliceStable(primaryKeys, func(i, j int) bool {
+		return primaryKeyOrder(primaryKeys[i]) < primaryKeyOrder(primaryKeys[j])
+	})
+	var primaryKey []string
+	for _, col := range primaryKeys {
+		primaryKey = append(primaryKey, col.Field)
+	}
+
+	var previousNames []string
+	for _, name := range strings.Split(def.Meta["previousNames"], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			if !strings.Contains(name, ".") {
+				name = model.QualifiedName(schema, name)
+			}
+			previousNames = append(previousNames, name)
 		}
+	}
 
-		var indexList []model.Index
-		for _, v := range indexMap {
-			indexList = append(indexList, model.Index{
-				Unique:    v.Unique,
-				Name:      v.Name,
-				Columns:   v.Columns,
-				TableName: "",
-			})
+	for i := range foreignKeys {
+		foreignKeys[i].Name = "fk_" + tableName + "_" + strings.Join(foreignKeys[i].Columns, "_")
+		// 未指定 schema 的引用表与当前表在同一 schema
+		if refSchema, refTable := model.SplitQualifiedName(foreignKeys[i].RefTable); refSchema == "" {
+			foreignKeys[i].RefTable = model.QualifiedName(schema, refTable)
+		} else {
+			foreignKeys[i].RefTable = model.QualifiedName(refSchema, refTable)
 		}
+	}
 
-		tableMap[tableName] = &model.Table{
-			Name:    tableName,
-			Comment: strings.ReplaceAll(commentVal.String(), "'", "\\'"),
-			Charset: charset,
-			Columns: cols,
-			Index:   indexList,
+	// 列级约束 chk_表名_列名, 表级约束(checks:"a > 0;b < 10") chk_表名_序号
+	for i := range checks {
+		checks[i].Name = "chk_" + tableName + "_" + checks[i].Name
+	}
+	checkNo := 0
+	for _, expr := range strings.Split(def.Meta["checks"], ";") {
+		if expr = strings.TrimSpace(expr); expr != "" {
+			checkNo++
+			checks = append(checks, model.Check{Name: fmt.Sprintf("chk_%s_%d", tableName, checkNo), Expr: expr})
 		}
+	}
 
+	var indexList []model.Index
+	for _, v := range indexMap {
+		indexList = append(indexList, model.Index{
+			Unique:    v.Unique,
+			Name:      v.Name,
+			Columns:   v.Columns,
+			TableName: "",
+		})
 	}
+	// map 遍历顺序不固定, 按名称排序保证结构可比较(SchemaChecksum)
+	sort.Slice(indexList, func(i, j int) bool {
+		return indexList[i].Name < indexList[j].Name
+	})
 
-	return model.Schema{
-		Tables: tableMap,
+	return &model.Table{
+		Name:          model.QualifiedName(schema, tableName),
+		Comment:       strings.ReplaceAll(def.Meta["comment"], "'", "\\'"),
+		Charset:       def.Meta["charset"],
+		Collation:     def.Meta["collate"],
+		PrimaryKey:    primaryKey,
+		Columns:       cols,
+		Index:         indexList,
+		ForeignKeys:   foreignKeys,
+		Checks:        checks,
+		PreviousNames: previousNames,
+		OnlineDDL:     def.Meta["onlineDDL"],
+	}
+}
+
+// tableSchema 仅 pgsql 支持 schema, 其余数据库中 schema.table 会被当作一个表名
+func (s *Syncer) tableSchema(def tableDef) string {
+	if s.DatabaseType != "pgsql" {
+		return ""
+	}
+	if schema := def.Meta["schema"]; schema != "" {
+		return schema
+	}
+	return s.DefaultSchema
+}
+
+func parseForeignKey(col model.Column, ref string) model.ForeignKey {
+	refTable, refColumn := ref, "id"
+	if i := strings.LastIndex(ref, "."); i > 0 {
+		refTable, refColumn = ref[:i], ref[i+1:]
+	}
+	return model.ForeignKey{
+		Columns:    []string{col.Field},
+		RefTable:   refTable,
+		RefColumns: []string{refColumn},
+		OnDelete:   foreignKeyAction(col.DDLTag["onDelete"]),
+		OnUpdate:   foreignKeyAction(col.DDLTag["onUpdate"]),
+	}
+}
+
+func foreignKeyAction(action string) string {
+	action = strings.ToUpper(strings.TrimSpace(action))
+	if action == "" {
+		return "NO ACTION"
+	}
+	return action
+}
+
+func primaryKeyOrder(col model.Column) int {
+	if v := col.DDLTag[model.DDLPrimaryKey]; v != "true" {
+		return gconv.Int(v)
 	}
+	return 0
 }
 
 func GetTableMeta(object interface{}, key string) *gvar.Var {
+	v, ok := tableMeta(object)[key]
+	if !ok {
+		return nil
+	}
+	return gvar.New(v)
+}
 
+// tableMeta 结构体中 TableMeta 字段的标签
+func tableMeta(object interface{}) map[string]string {
 	tags := map[string]string{}
 	reflectType, err := gstructs.StructType(object)
 	if err != nil {
-		return nil
+		return tags
 	}
 	if field, ok := reflectType.FieldByName("TableMeta"); ok {
 		if field.Type.String() == "tablesync.TableMeta" {
 			tags = gstructs.ParseTag(string(field.Tag))
 		}
 	}
-
-	v, ok := tags[key]
-	if !ok {
-		return nil
-	}
-	return gvar.New(v)
+	return tags
 }
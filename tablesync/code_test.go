@@ -0,0 +1,65 @@
+package tablesync
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/glennliao/table-sync/model"
+)
+
+type schemaInvoice struct {
+	TableMeta `tableName:"invoice" schema:"billing" previousNames:"bill"`
+	Id        int64 `ddl:"primaryKey"`
+	UserId    int64 `ddl:"fk:user.id"`
+}
+
+type schemaLegacy struct {
+	TableMeta `tableName:"legacy"`
+	Id        int64 `ddl:"primaryKey"`
+}
+
+// schema 标签及 DefaultSchema 仅在 pgsql 中生效
+func TestTableSchema(t *testing.T) {
+	syncer := &Syncer{Tables: []Table{schemaInvoice{}, schemaLegacy{}}, DefaultSchema: "app"}
+
+	for _, dialect := range []string{"mysql", "sqlite"} {
+		snapshot, err := syncer.CodeSnapshot(dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		schema := snapshot.Schema()
+		if schema.Tables["invoice"] == nil || schema.Tables["legacy"] == nil {
+			t.Errorf("%s: tables should not be qualified, got %v", dialect, schema.Tables)
+			continue
+		}
+		if got := schema.Tables["invoice"].ForeignKeys[0].RefTable; got != "user" {
+			t.Errorf("%s: foreign key should reference user, got %s", dialect, got)
+		}
+		plan, err := Diff(model.Schema{}, schema, dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sql := strings.Join(plan.SqlList(), "\n"); strings.Contains(sql, "billing") || strings.Contains(sql, "app.") {
+			t.Errorf("%s: sql should not reference pgsql schemas:\n%s", dialect, sql)
+		}
+	}
+
+	snapshot, err := syncer.CodeSnapshot("pgsql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := snapshot.Schema()
+	invoice, legacy := schema.Tables["billing.invoice"], schema.Tables["app.legacy"]
+	if invoice == nil || legacy == nil {
+		t.Fatalf("pgsql tables should be qualified, got %v", schema.Tables)
+	}
+	if got := invoice.ForeignKeys[0].RefTable; got != "billing.user" {
+		t.Errorf("foreign key should reference the same schema, got %s", got)
+	}
+	if got := strings.Join(invoice.PreviousNames, ","); got != "billing.bill" {
+		t.Errorf("previous names should be qualified, got %s", got)
+	}
+	if got := strings.Join(codeSchemas(schema), ","); got != "app,billing,public" {
+		t.Errorf("schemas to load: got %s", got)
+	}
+}
@@ -0,0 +1,273 @@
+package tablesync
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/glennliao/table-sync/model"
+)
+
+type diffUserV1 struct {
+	TableMeta `tableName:"user"`
+	Id        int64  `ddl:"primaryKey"`
+	Name      string `ddl:"size:64;comment:用户名"`
+	Nick      string `ddl:"size:64"`
+	Age       int    `ddl:"default:0"`
+}
+
+type diffUserV2 struct {
+	TableMeta `tableName:"user"`
+	Id        int64  `ddl:"primaryKey"`
+	UserName  string `ddl:"size:64;comment:用户名;was:name"`
+	Age       int    `ddl:"default:0"`
+	Email     string `ddl:"size:128;uniqueIndex"`
+}
+
+func codeSchema(t *testing.T, table Table) model.Schema {
+	snapshot, err := (&Syncer{Tables: []Table{table}}).CodeSnapshot("mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snapshot.Schema()
+}
+
+func TestDiff(t *testing.T) {
+	from, to := codeSchema(t, diffUserV1{}), codeSchema(t, diffUserV2{})
+
+	plan, err := Diff(from, from, "mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Empty() {
+		t.Errorf("diff of identical schema should be empty, got:\n%s", plan)
+	}
+
+	plan, err = Diff(from, to, "mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := map[string]string{}
+	for _, item := range plan.Sql {
+		kinds[item.Kind+" "+item.Name] = strings.Join(item.Sql, ";")
+	}
+	for _, want := range []string{
+		model.KindRenameColumn + " user_name",
+		model.KindAddColumn + " email",
+		model.KindAddIndex + " uk_email",
+		model.KindDropColumn + " nick",
+	} {
+		if _, exists := kinds[want]; !exists {
+			t.Errorf("missing %s in plan:\n%s", want, plan)
+		}
+	}
+	if len(plan.Sql) != 4 {
+		t.Errorf("unexpected operations in plan:\n%s", plan)
+	}
+
+	plan, err = (&Syncer{}).Diff(from, to, "mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range plan.Sql {
+		if item.Kind == model.KindDropColumn {
+			t.Errorf("drop column without AllowDropColumn: %v", item.Sql)
+		}
+	}
+
+	if _, err = Diff(from, to, "oracle"); err == nil {
+		t.Error("unsupported dialect should return error")
+	}
+}
+
+type diffUserV3 struct {
+	TableMeta `tableName:"user"`
+	Id        int64  `ddl:"primaryKey"`
+	Name      string `ddl:"size:128;comment:用户名"`
+	Nick      string `ddl:"size:8"`
+	Age       int64  `ddl:"default:0"`
+}
+
+func TestDiffSafety(t *testing.T) {
+	from, to := codeSchema(t, diffUserV1{}), codeSchema(t, diffUserV3{})
+
+	plan, err := Diff(from, to, "mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"name": model.SafetyBlocking,
+		"nick": model.SafetyDestructive,
+		"age":  model.SafetyBlocking,
+	}
+	for _, item := range plan.Sql {
+		if item.Kind == model.KindAlterColumn && item.Safety != want[item.Name] {
+			t.Errorf("%s: want %s, got %s (%s)", item.Name, want[item.Name], item.Safety, item.Reason)
+		}
+	}
+
+	err = (&Syncer{}).checkSafety(plan)
+	if err == nil || !strings.Contains(err.Error(), "user.nick") || strings.Contains(err.Error(), "user.name") {
+		t.Errorf("want error listing user.nick only, got %v", err)
+	}
+	if err = (&Syncer{AllowDestructive: true}).checkSafety(plan); err != nil {
+		t.Error(err)
+	}
+}
+
+type diffLegacy struct {
+	TableMeta `tableName:"legacy" comment:"it's legacy"`
+	Id        int64 `ddl:"primaryKey"`
+}
+
+type diffLegacyLatin1 struct {
+	TableMeta `tableName:"legacy" comment:"it's legacy" charset:"latin1"`
+	Id        int64 `ddl:"primaryKey"`
+}
+
+type diffLegacyUtf8 struct {
+	TableMeta `tableName:"legacy" comment:"it's legacy" collate:"utf8_general_ci"`
+	Id        int64 `ddl:"primaryKey"`
+}
+
+func TestDiffCharset(t *testing.T) {
+	withCharset := func(schema model.Schema, charset, collation string) model.Schema {
+		table := *schema.Tables["legacy"]
+		table.Charset, table.Collation = charset, collation
+		return model.Schema{Tables: map[string]*model.Table{"legacy": &table}}
+	}
+	alterSafety := func(from, to model.Schema) string {
+		plan, err := Diff(from, to, "mysql")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range plan.Sql {
+			if item.Kind == model.KindAlterTable {
+				return item.Safety
+			}
+		}
+		return ""
+	}
+
+	legacy, latin1, utf8 := codeSchema(t, diffLegacy{}), codeSchema(t, diffLegacyLatin1{}), codeSchema(t, diffLegacyUtf8{})
+	tests := []struct {
+		name     string
+		from, to model.Schema
+		want     string
+	}{
+		{"charset not declared", withCharset(legacy, "latin1", "latin1_swedish_ci"), legacy, ""},
+		{"utf8 is utf8mb3", withCharset(legacy, "utf8mb3", "utf8mb3_general_ci"), utf8, ""},
+		{"widen to utf8mb4", withCharset(legacy, "latin1", "latin1_swedish_ci"), withCharset(legacy, "utf8mb4", ""), model.SafetyBlocking},
+		{"narrow to latin1", withCharset(legacy, "utf8mb4", "utf8mb4_general_ci"), latin1, model.SafetyDestructive},
+	}
+	for _, tt := range tests {
+		if got := alterSafety(tt.from, tt.to); got != tt.want {
+			t.Errorf("%s: want alter table %q, got %q", tt.name, tt.want, got)
+		}
+	}
+
+	// pgsql 中注释的单引号转义为 ''
+	snapshot, err := (&Syncer{Tables: []Table{diffLegacy{}}}).CodeSnapshot("pgsql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := Diff(model.Schema{}, snapshot.Schema(), "pgsql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sql := strings.Join(plan.SqlList(), "\n"); !strings.Contains(sql, "'it''s legacy'") || strings.Contains(sql, `\'`) {
+		t.Errorf("pgsql comment should be escaped with '':\n%s", sql)
+	}
+}
+
+type diffOrderItem struct {
+	TableMeta `tableName:"order_item" previousNames:"item"`
+	OrderId   int64 `ddl:"primaryKey"`
+	LineNo    int64 `ddl:"primaryKey"`
+}
+
+// pgsql 按数据库中的约束名删除主键, 回滚时按原约束名重建
+func TestDiffPrimaryKeyName(t *testing.T) {
+	snapshot, err := (&Syncer{Tables: []Table{diffOrderItem{}}}).CodeSnapshot("pgsql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := snapshot.Schema()
+
+	item := *code.Tables["order_item"]
+	item.Name, item.PrimaryKey, item.PrimaryKeyName = "item", []string{"order_id"}, "item_pk"
+	db := model.Schema{Tables: map[string]*model.Table{"item": &item}}
+
+	plan, err := Diff(db, code, "pgsql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	up, down := plan.String(), plan.DownString()
+	if !strings.Contains(up, `DROP CONSTRAINT "item_pk"`) || !strings.Contains(up, `ADD PRIMARY KEY ("order_id", "line_no")`) {
+		t.Errorf("primary key should be dropped by its name:\n%s", up)
+	}
+	if !strings.Contains(down, `DROP CONSTRAINT "order_item_pkey"`) || !strings.Contains(down, `ADD CONSTRAINT "item_pk" PRIMARY KEY ("order_id")`) {
+		t.Errorf("rollback should restore the original constraint name:\n%s", down)
+	}
+}
+
+type concurrentPostV1 struct {
+	TableMeta `tableName:"post"`
+	Id        int64  `ddl:"primaryKey"`
+	Title     string `ddl:"size:64;index:title"`
+	UserId    int64
+}
+
+type concurrentPostV2 struct {
+	TableMeta `tableName:"post"`
+	Id        int64  `ddl:"primaryKey"`
+	Title     string `ddl:"size:64;index:title"`
+	UserId    int64  `ddl:"index:title"`
+}
+
+// 并发创建时列变更的索引以临时名称创建后替换, 事务中不删除原索引
+func TestDiffConcurrentIndex(t *testing.T) {
+	schema := func(table Table) model.Schema {
+		snapshot, err := (&Syncer{Tables: []Table{table}}).CodeSnapshot("pgsql")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return snapshot.Schema()
+	}
+	syncer := &Syncer{ConcurrentIndex: true, AllowDropIndex: true}
+	plan, err := syncer.Diff(schema(concurrentPostV1{}), schema(concurrentPostV2{}), "pgsql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var recreate *model.SyncSql
+	for i, item := range plan.Sql {
+		if item.Kind == model.KindDropIndex {
+			t.Errorf("index should not be dropped before the new one is built: %v", item.Sql)
+		}
+		if item.Kind == model.KindAddIndex && item.Name == "idx_title" {
+			recreate = &plan.Sql[i]
+		}
+	}
+	if recreate == nil {
+		t.Fatalf("missing recreated index in plan:\n%s", plan)
+	}
+	if !recreate.NoTx {
+		t.Error("recreated index should run outside the transaction")
+	}
+	want := []string{
+		`DROP INDEX CONCURRENTLY IF EXISTS "idx_title__new"`,
+		`CREATE  INDEX CONCURRENTLY "idx_title__new" ON "post" (title, user_id)`,
+		`DROP INDEX CONCURRENTLY IF EXISTS "idx_title"`,
+		`ALTER INDEX "idx_title__new" RENAME TO "idx_title"`,
+	}
+	if got := strings.Join(recreate.Sql, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", got, strings.Join(want, "\n"))
+	}
+	if got := recreate.Down[1]; !strings.HasSuffix(got, `"idx_title__new" ON "post" (title)`) {
+		t.Errorf("down should restore the original columns, got %s", got)
+	}
+	// 创建失败时只删除临时索引, 原索引保留
+	if got := strings.Join(recreate.Cleanup, "\n"); got != `DROP INDEX CONCURRENTLY IF EXISTS "idx_title__new"` {
+		t.Errorf("cleanup should only drop the temp index, got %s", got)
+	}
+}
@@ -0,0 +1,208 @@
+package tablesync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+
+	"github.com/glennliao/table-sync/database"
+	"github.com/glennliao/table-sync/model"
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/text/gstr"
+)
+
+// 同步工具自身使用的表, 生成结构体时跳过
+var internalTables = map[string]struct{}{
+	HistoryTableName: {},
+	"tablesync_lock": {},
+}
+
+// GenerateFromDB 读取数据库结构并生成结构体源码, schemas 为 pgsql 中读取的 schema, 默认 public
+func GenerateFromDB(ctx context.Context, db gdb.DB, packageName string, schemas ...string) ([]byte, error) {
+	driver, err := Driver(db)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := LoadSchema(ctx, db, schemas...)
+	if err != nil {
+		return nil, err
+	}
+	return GenerateStructs(ctx, schema, driver, packageName)
+}
+
+// GenerateStructs 按数据库结构生成嵌入 tablesync.TableMeta 并带 ddl 标签的结构体源码,
+// 生成的结构体同步到原数据库时应无变更, 无法用标签表达的部分以 TODO 注释标出
+func GenerateStructs(ctx context.Context, schema model.Schema, driver database.Database, packageName string) ([]byte, error) {
+	var names []string
+	for name := range schema.Tables {
+		if _, exists := internalTables[name]; !exists {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var body bytes.Buffer
+	var importTime bool
+	for _, name := range names {
+		code, usesTime := generateStruct(ctx, *schema.Tables[name], driver)
+		importTime = importTime || usesTime
+		body.WriteString(code)
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "package %s\n\nimport (\n", packageName)
+	if importTime {
+		src.WriteString("\t\"time\"\n\n")
+	}
+	src.WriteString("\t\"github.com/glennliao/table-sync/tablesync\"\n)\n")
+	src.Write(body.Bytes())
+
+	return format.Source(src.Bytes())
+}
+
+func generateStruct(ctx context.Context, table model.Table, driver database.Database) (code string, usesTime bool) {
+	var b strings.Builder
+
+	schema, tableName := model.SplitQualifiedName(table.Name)
+	meta := []string{fmt.Sprintf(`tableName:"%s"`, tableName)}
+	if schema != "" {
+		meta = append(meta, fmt.Sprintf(`schema:"%s"`, schema))
+	}
+	if table.Comment != "" {
+		meta = append(meta, fmt.Sprintf(`comment:"%s"`, tagValue(table.Comment)))
+	}
+	if table.Charset != "" {
+		meta = append(meta, fmt.Sprintf(`charset:"%s"`, table.Charset))
+	}
+	if table.Collation != "" {
+		meta = append(meta, fmt.Sprintf(`collate:"%s"`, table.Collation))
+	}
+
+	// 列级约束 chk_表名_列名 写在列上, 其余写到表级 checks
+	columnChecks := map[string]string{}
+	var tableChecks []string
+	for _, check := range table.Checks {
+		field := strings.TrimPrefix(check.Name, "chk_"+tableName+"_")
+		if hasColumn(table, field) {
+			columnChecks[field] = check.Expr
+		} else {
+			tableChecks = append(tableChecks, tagValue(check.Expr))
+		}
+	}
+	if len(tableChecks) > 0 {
+		meta = append(meta, fmt.Sprintf(`checks:"%s"`, strings.Join(tableChecks, ";")))
+	}
+
+	var todo []string
+
+	// 单列索引及按 idx_/uk_ 命名的联合索引可用标签表达
+	columnIndex := map[string][]string{}
+	for _, index := range table.Index {
+		prefix, tag := "idx_", "index"
+		if index.Unique {
+			prefix, tag = "uk_", model.DDLUniqueIndex
+		}
+		if len(index.Columns) == 1 && index.Name == prefix+index.Columns[0] {
+			columnIndex[index.Columns[0]] = append(columnIndex[index.Columns[0]], tag)
+			continue
+		}
+		if !strings.HasPrefix(index.Name, prefix) {
+			todo = append(todo, fmt.Sprintf("index %s (%s) will be renamed to %s", index.Name, strings.Join(index.Columns, ","), prefix+index.Name))
+			prefix = ""
+		}
+		for _, column := range index.Columns {
+			columnIndex[column] = append(columnIndex[column], tag+":"+strings.TrimPrefix(index.Name, prefix))
+		}
+	}
+
+	// 外键仅支持单列且按 fk_表名_列名 命名
+	columnForeignKey := map[string]model.ForeignKey{}
+	for _, fk := range table.ForeignKeys {
+		if len(fk.Columns) == 1 && fk.Name == "fk_"+tableName+"_"+fk.Columns[0] {
+			columnForeignKey[fk.Columns[0]] = fk
+			continue
+		}
+		todo = append(todo, fmt.Sprintf("foreign key %s (%s) references %s (%s) is not generated", fk.Name, strings.Join(fk.Columns, ","), fk.RefTable, strings.Join(fk.RefColumns, ",")))
+	}
+
+	var fields []string
+	for _, column := range table.Columns {
+		goType, size := driver.GetGoType(ctx, column.Type)
+		var tags []string
+
+		if column.PrimaryKey {
+			if len(table.PrimaryKey) > 1 {
+				for i, field := range table.PrimaryKey {
+					if field == column.Field {
+						tags = append(tags, fmt.Sprintf("%s:%d", model.DDLPrimaryKey, i+1))
+					}
+				}
+			} else {
+				tags = append(tags, model.DDLPrimaryKey)
+			}
+		}
+
+		if size != "" {
+			tags = append(tags, "size:"+size)
+		}
+		if !strings.EqualFold(driver.GetSqlType(ctx, goType, size), column.Type) {
+			tags = append(tags, "type:"+column.Type)
+		}
+		if column.NotNull == "not null" && !column.PrimaryKey {
+			tags = append(tags, "not null")
+		}
+		if column.Default != "" {
+			value := column.Default
+			if goType == "string" && !strings.HasPrefix(value, "'") && !strings.Contains(value, "(") && !strings.EqualFold(value, "CURRENT_TIMESTAMP") {
+				value = "'" + value + "'"
+			}
+			tags = append(tags, "default:"+value)
+		}
+		if column.Comment != "" {
+			tags = append(tags, "comment:"+tagValue(column.Comment))
+		}
+		tags = append(tags, columnIndex[column.Field]...)
+		if fk, exists := columnForeignKey[column.Field]; exists {
+			tags = append(tags, fmt.Sprintf("%s:%s.%s", model.DDLForeignKey, fk.RefTable, fk.RefColumns[0]))
+			if action := strings.ToLower(fk.OnDelete); action != "" && action != "no action" {
+				tags = append(tags, "onDelete:"+action)
+			}
+			if action := strings.ToLower(fk.OnUpdate); action != "" && action != "no action" {
+				tags = append(tags, "onUpdate:"+action)
+			}
+		}
+		if expr, exists := columnChecks[column.Field]; exists {
+			tags = append(tags, model.DDLCheck+":"+tagValue(expr))
+		}
+
+		fieldName := gstr.CaseCamel(column.Field)
+		if convertCamelToUnderScore(fieldName) != column.Field {
+			todo = append(todo, fmt.Sprintf("column %s can not be derived from field name %s", column.Field, fieldName))
+		}
+		usesTime = usesTime || goType == "time.Time"
+
+		field := fmt.Sprintf("\t%s %s", fieldName, goType)
+		if len(tags) > 0 {
+			field += fmt.Sprintf(" `ddl:\"%s\"`", strings.Join(tags, ";"))
+		}
+		fields = append(fields, field)
+	}
+
+	structName := gstr.CaseCamel(strings.ReplaceAll(table.Name, ".", "_"))
+	b.WriteString("\n")
+	for _, line := range todo {
+		b.WriteString("// TODO " + line + "\n")
+	}
+	fmt.Fprintf(&b, "type %s struct {\n\ttablesync.TableMeta `%s`\n", structName, strings.Join(meta, " "))
+	b.WriteString(strings.Join(fields, "\n"))
+	b.WriteString("\n}\n")
+	return b.String(), usesTime
+}
+
+// tagValue 标签值中的双引号和分号会破坏标签解析
+func tagValue(s string) string {
+	return strings.NewReplacer(`"`, `'`, ";", ",", "`", "'", "\n", " ").Replace(s)
+}
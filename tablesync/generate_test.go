@@ -0,0 +1,120 @@
+package tablesync
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 与生成的结构体一致, 用于验证同步到原数据库时无变更
+type genUser struct {
+	TableMeta `tableName:"user"`
+	Id        int64  `ddl:"primaryKey"`
+	Name      string `ddl:"size:32;not null;default:'guest';uniqueIndex"`
+	CreatedAt time.Time
+}
+
+type genUserRole struct {
+	TableMeta `tableName:"user_role"`
+	UserId    int64 `ddl:"primaryKey:1;fk:user.id;onDelete:cascade"`
+	RoleId    int64 `ddl:"primaryKey:2"`
+}
+
+func TestGenerateFromDB(t *testing.T) {
+	ctx := context.Background()
+	db := sqliteDB(t)
+	for _, sql := range []string{
+		"CREATE TABLE user (id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL, name varchar(32) NOT NULL DEFAULT 'guest', created_at datetime)",
+		"CREATE UNIQUE INDEX user_uk_name ON user (name)",
+		"CREATE TABLE user_role (user_id INTEGER NOT NULL, role_id INTEGER NOT NULL, PRIMARY KEY (user_id, role_id), " +
+			"CONSTRAINT fk_user_role_user FOREIGN KEY (user_id) REFERENCES user (id) ON DELETE CASCADE)",
+		"CREATE TABLE tablesync_lock (name varchar(64) PRIMARY KEY NOT NULL)",
+	} {
+		if _, err := db.Exec(ctx, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	src, err := GenerateFromDB(ctx, db, "entity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, imports := parseStructs(t, src)
+	want := map[string][]string{
+		"User": {
+			"tablesync.TableMeta `tableName:\"user\"`",
+			"Id int64 `ddl:\"primaryKey\"`",
+			"Name string `ddl:\"size:32;not null;default:'guest';uniqueIndex\"`",
+			"CreatedAt time.Time",
+		},
+		"UserRole": {
+			"tablesync.TableMeta `tableName:\"user_role\"`",
+			"UserId int64 `ddl:\"primaryKey:1;fk:user.id;onDelete:cascade\"`",
+			"RoleId int64 `ddl:\"primaryKey:2\"`",
+		},
+	}
+	if len(fields) != len(want) {
+		t.Errorf("generated structs %v, want %v (internal tables should be skipped)", fields, want)
+	}
+	for name, list := range want {
+		if got := strings.Join(fields[name], "\n"); got != strings.Join(list, "\n") {
+			t.Errorf("struct %s fields:\n%s\nwant:\n%s", name, got, strings.Join(list, "\n"))
+		}
+	}
+	if !slices.Contains(imports, "time") {
+		t.Errorf("generated code should import time, got %v", imports)
+	}
+
+	plan, err := (&Syncer{Tables: []Table{genUser{}, genUserRole{}}}).Plan(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Empty() {
+		t.Errorf("generated structs should match the database, got:\n%s", plan)
+	}
+}
+
+// parseStructs 解析生成的代码, 返回各结构体的字段(名称 类型 标签)及导入的包
+func parseStructs(t *testing.T, src []byte) (map[string][]string, []string) {
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+	if err != nil {
+		t.Fatalf("generated code should compile: %v\n%s", err, src)
+	}
+	if file.Name.Name != "entity" {
+		t.Errorf("package %s, want entity", file.Name.Name)
+	}
+
+	var imports []string
+	for _, spec := range file.Imports {
+		imports = append(imports, strings.Trim(spec.Path.Value, `"`))
+	}
+
+	structs := map[string][]string{}
+	ast.Inspect(file, func(node ast.Node) bool {
+		spec, ok := node.(*ast.TypeSpec)
+		if !ok {
+			return true
+		}
+		if st, ok := spec.Type.(*ast.StructType); ok {
+			for _, field := range st.Fields.List {
+				var parts []string
+				for _, name := range field.Names {
+					parts = append(parts, name.Name)
+				}
+				parts = append(parts, types.ExprString(field.Type))
+				if field.Tag != nil {
+					parts = append(parts, field.Tag.Value)
+				}
+				structs[spec.Name.Name] = append(structs[spec.Name.Name], strings.Join(parts, " "))
+			}
+		}
+		return false
+	})
+	return structs, imports
+}
@@ -0,0 +1,122 @@
+package tablesync
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/errors/gerror"
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// SyncResult 单个数据库分组的同步结果
+type SyncResult struct {
+	Group string
+	Plan  *Plan // 执行的同步计划, 获取连接或比较结构失败时为 nil
+	Err   error
+}
+
+// SyncAll 按 TableMeta 的 group 标签(结构文件中的 group)将表同步到对应的 gf 数据库分组, 未指定时为 default 分组.
+// 各分组依次独立同步, 一个分组失败不影响其余分组, 返回各分组的结果及失败分组的汇总错误
+func (s *Syncer) SyncAll(ctx context.Context) ([]SyncResult, error) {
+	groups, err := s.groups()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SyncResult
+	var failed []string
+	for _, group := range groups {
+		result := s.syncGroup(ctx, group)
+		if result.Err != nil {
+			failed = append(failed, group+": "+result.Err.Error())
+		}
+		results = append(results, result)
+	}
+
+	if len(failed) > 0 {
+		return results, gerror.Newf("sync failed for groups:\n  %s", strings.Join(failed, "\n  "))
+	}
+	return results, nil
+}
+
+func (s *Syncer) syncGroup(ctx context.Context, group string) (result SyncResult) {
+	result.Group = group
+
+	db, err := groupDB(group)
+	if err != nil {
+		result.Err = err
+		return
+	}
+
+	syncer := *s
+	syncer.Group = group
+
+	unlock, err := syncer.lock(ctx, db)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	defer unlock()
+
+	if result.Plan, result.Err = syncer.Plan(ctx, db); result.Err != nil {
+		return
+	}
+	result.Err = syncer.sync(ctx, db, result.Plan)
+	return
+}
+
+// groups 表定义中出现的数据库分组, 按名称排序
+func (s *Syncer) groups() ([]string, error) {
+	var groupMap = map[string]struct{}{}
+	for _, table := range s.Tables {
+		def, err := structTableDef(table)
+		if err != nil {
+			return nil, err
+		}
+		groupMap[tableGroup(def)] = struct{}{}
+	}
+	for _, path := range s.SchemaFiles {
+		defs, err := loadSchemaFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, def := range defs {
+			groupMap[tableGroup(def)] = struct{}{}
+		}
+	}
+
+	var groups []string
+	for group := range groupMap {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+func tableGroup(def tableDef) string {
+	if group := def.Meta["group"]; group != "" {
+		return group
+	}
+	return gdb.DefaultGroupName
+}
+
+// inGroup 未设置 Group 时仅处理 default 分组的表
+func (s *Syncer) inGroup(def tableDef) bool {
+	group := s.Group
+	if group == "" {
+		group = gdb.DefaultGroupName
+	}
+	return tableGroup(def) == group
+}
+
+// groupDB g.DB 在分组未配置时 panic, 转为错误返回
+func groupDB(group string) (db gdb.DB, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = gerror.Newf("database group %s: %v", group, r)
+		}
+	}()
+	return g.DB(group), nil
+}
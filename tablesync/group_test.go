@@ -0,0 +1,66 @@
+package tablesync
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/gogf/gf/v2/database/gdb"
+)
+
+type groupUser struct {
+	TableMeta `tableName:"user"`
+	Id        int64 `ddl:"primaryKey"`
+}
+
+type groupAccessLog struct {
+	TableMeta `tableName:"access_log" group:"log"`
+	Id        int64 `ddl:"primaryKey"`
+}
+
+// 未通过 SyncAll 指定分组时只处理 default 分组的表
+func TestPlanDefaultGroup(t *testing.T) {
+	plan, err := (&Syncer{Tables: []Table{groupUser{}, groupAccessLog{}}}).Plan(context.Background(), sqliteDB(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Task.CreateTable) != 1 || plan.Task.CreateTable[0].Name != "user" {
+		t.Errorf("only default group tables should be created, got %v", plan.Task.CreateTable)
+	}
+}
+
+func TestSyncAll(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, group := range []string{gdb.DefaultGroupName, "log"} {
+		gdb.SetConfigGroup(group, gdb.ConfigGroup{{Type: "sqlite", Name: filepath.Join(dir, group+".db")}})
+	}
+
+	results, err := (&Syncer{Tables: []Table{groupUser{}, groupAccessLog{}}}).SyncAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{gdb.DefaultGroupName: "user", "log": "access_log"}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for _, result := range results {
+		db, err := groupDB(result.Group)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tables, err := db.Tables(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var synced []string
+		for _, table := range tables {
+			if table == "user" || table == "access_log" {
+				synced = append(synced, table)
+			}
+		}
+		if len(synced) != 1 || synced[0] != want[result.Group] {
+			t.Errorf("group %s: got tables %v, want %s", result.Group, tables, want[result.Group])
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package tablesync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/glennliao/table-sync/model"
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/os/gtime"
+)
+
+const HistoryTableName = "tablesync_history"
+
+const (
+	HistoryActionSync     = "sync"
+	HistoryActionRollback = "rollback"
+
+	HistoryStateSuccess = "success"
+	HistoryStateFailed  = "failed"
+)
+
+// History 同步历史, Syncer.RecordHistory 开启后每次执行SQL的同步/回滚都会记录
+type History struct {
+	TableMeta    `tableName:"tablesync_history" comment:"table-sync history"`
+	Id           int64     `ddl:"primaryKey;AUTO_INCREMENT" json:"id"`
+	CreatedAt    time.Time `json:"createdAt"`
+	Action       string    `ddl:"size:16;comment:sync/rollback" json:"action"`
+	Host         string    `ddl:"size:128" json:"host"`
+	AppVersion   string    `ddl:"size:64" json:"appVersion"`
+	DatabaseType string    `ddl:"size:16" json:"databaseType"`
+	Checksum     string    `ddl:"size:64;comment:代码中表结构的sha256" json:"checksum"`
+	Statements   string    `ddl:"type:text" json:"statements"`
+	State        string    `ddl:"size:16;comment:success/failed" json:"state"`
+	Error        string    `ddl:"type:text" json:"error"`
+}
+
+// ListHistory 按时间倒序查询同步历史, limit <= 0 时返回全部
+func ListHistory(ctx context.Context, db gdb.DB, limit int) (list []History, err error) {
+	m := db.Model(HistoryTableName).Ctx(ctx).OrderDesc("id")
+	if limit > 0 {
+		m = m.Limit(limit)
+	}
+	err = m.Scan(&list)
+	return
+}
+
+// SchemaChecksum 表结构的 sha256, 用于判断代码中的结构是否变化
+func SchemaChecksum(schema model.Schema) string {
+	data, _ := json.Marshal(schema.Tables)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// recordHistory 历史表不存在时先创建, 同步失败时事务已回滚, 记录在事务外写入
+func (s *Syncer) recordHistory(ctx context.Context, db gdb.DB, plan *Plan, action string, statements string, syncErr error) error {
+	historySyncer := &Syncer{Tables: []Table{History{}}}
+	if err := historySyncer.Sync(ctx, db); err != nil {
+		return err
+	}
+
+	host, _ := os.Hostname()
+	state, errMsg := HistoryStateSuccess, ""
+	if syncErr != nil {
+		state, errMsg = HistoryStateFailed, syncErr.Error()
+	}
+
+	_, err := db.Model(HistoryTableName).Ctx(ctx).Data(g.Map{
+		"created_at":    gtime.Now(),
+		"action":        action,
+		"host":          host,
+		"app_version":   s.AppVersion,
+		"database_type": plan.DatabaseType,
+		"checksum":      SchemaChecksum(plan.Task.SchemaInCode),
+		"statements":    statements,
+		"state":         state,
+		"error":         errMsg,
+	}).Insert()
+	return err
+}
@@ -0,0 +1,59 @@
+package tablesync
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type historyPost struct {
+	TableMeta `tableName:"post"`
+	Id        int64  `ddl:"primaryKey"`
+	Title     string `ddl:"size:32;not null"`
+}
+
+// 执行SQL的同步记录一条历史, 无变更时不记录, 失败时记录错误
+func TestRecordHistory(t *testing.T) {
+	ctx := context.Background()
+	db := sqliteDB(t)
+	syncer := &Syncer{Tables: []Table{historyPost{}}, RecordHistory: true, AppVersion: "v1.0.0"}
+
+	mustSync(t, db, syncer)
+	if err := syncer.Sync(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	list, err := ListHistory(ctx, db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("sync without changes should not be recorded, got %d records", len(list))
+	}
+	if h := list[0]; h.Action != HistoryActionSync || h.State != HistoryStateSuccess || h.AppVersion != "v1.0.0" ||
+		h.DatabaseType != "sqlite" || len(h.Checksum) != 64 || !strings.Contains(h.Statements, "CREATE TABLE `post`") {
+		t.Errorf("got %+v", h)
+	}
+
+	// 已有空值时设置 not null 失败
+	if _, err = db.Exec(ctx, "DROP TABLE post"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec(ctx, "CREATE TABLE post (id INTEGER PRIMARY KEY, title varchar(32))"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec(ctx, "INSERT INTO post (id) VALUES (1)"); err != nil {
+		t.Fatal(err)
+	}
+	syncer.AllowDestructive, syncer.AppVersion = true, "v1.0.1"
+	if err = syncer.Sync(ctx, db); err == nil {
+		t.Fatal("sync should fail on null values")
+	}
+
+	list, err = ListHistory(ctx, db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].State != HistoryStateFailed || list[0].AppVersion != "v1.0.1" || list[0].Error == "" {
+		t.Errorf("failed sync should be recorded, got %+v", list)
+	}
+}
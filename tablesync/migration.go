@@ -0,0 +1,147 @@
+package tablesync
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gogf/gf/v2/errors/gerror"
+	"github.com/gogf/gf/v2/os/gfile"
+)
+
+var migrationFileRegex = regexp.MustCompile(`^(\d+)_.*\.(up|down)\.sql$`)
+var migrationNameRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// MigrationWriter 将同步计划写为版本化迁移文件 NNNN_description.up.sql / .down.sql,
+// 文件命名与 golang-migrate 等迁移工具兼容
+type MigrationWriter struct {
+	Dir string
+	// Timestamp 使用时间戳(20060102150405)作为版本号, 默认使用 4 位递增序号
+	Timestamp bool
+}
+
+// MigrationFile 生成的迁移文件
+type MigrationFile struct {
+	Version  string
+	UpPath   string
+	DownPath string
+	// NoTx 不能在事务中执行的操作(pgsql CONCURRENTLY)单独写入紧随其后的版本 NNNN_description_no_tx,
+	// 迁移工具需逐条执行且不开启事务(如 golang-migrate 的 x-multi-statement), 没有时为 nil
+	NoTx *MigrationFile
+}
+
+// Write 写入迁移文件, 计划为空时不生成文件并返回 nil
+func (w MigrationWriter) Write(plan *Plan, description string) (*MigrationFile, error) {
+	if plan == nil || plan.Empty() {
+		return nil, nil
+	}
+
+	name := strings.Trim(migrationNameRegex.ReplaceAllString(strings.ToLower(description), "_"), "_")
+	if name == "" {
+		return nil, gerror.New("migration description is empty")
+	}
+
+	version, err := w.nextVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	txPlan, noTxPlan := *plan, *plan
+	txPlan.Sql, noTxPlan.Sql = nil, nil
+	for _, item := range plan.Sql {
+		if item.NoTx {
+			noTxPlan.Sql = append(noTxPlan.Sql, item)
+		} else {
+			txPlan.Sql = append(txPlan.Sql, item)
+		}
+	}
+
+	header := fmt.Sprintf("-- %s\n-- database: %s\n", description, plan.DatabaseType)
+
+	var file, noTxFile *MigrationFile
+	if len(txPlan.Sql) > 0 {
+		file = w.file(version, name)
+	}
+	if len(noTxPlan.Sql) > 0 {
+		noTxVersion := version
+		if file != nil {
+			noTxVersion = w.followingVersion(version)
+		}
+		noTxFile = w.file(noTxVersion, name+"_no_tx")
+	}
+	for _, f := range []*MigrationFile{file, noTxFile} {
+		if f != nil && (gfile.Exists(f.UpPath) || gfile.Exists(f.DownPath)) {
+			return nil, gerror.Newf("migration file already exists: %s", f.UpPath)
+		}
+	}
+
+	if file != nil {
+		if err = w.put(file, header+"\n", &txPlan); err != nil {
+			return nil, err
+		}
+	}
+	if noTxFile == nil {
+		return file, nil
+	}
+	if err = w.put(noTxFile, header+"-- run each statement outside a transaction\n\n", &noTxPlan); err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return noTxFile, nil
+	}
+	file.NoTx = noTxFile
+	return file, nil
+}
+
+func (w MigrationWriter) file(version string, name string) *MigrationFile {
+	return &MigrationFile{
+		Version:  version,
+		UpPath:   filepath.Join(w.Dir, version+"_"+name+".up.sql"),
+		DownPath: filepath.Join(w.Dir, version+"_"+name+".down.sql"),
+	}
+}
+
+func (w MigrationWriter) put(file *MigrationFile, header string, plan *Plan) error {
+	if err := gfile.PutContents(file.UpPath, header+plan.String()); err != nil {
+		return err
+	}
+	return gfile.PutContents(file.DownPath, header+plan.DownString())
+}
+
+// followingVersion 紧随 version 的版本号
+func (w MigrationWriter) followingVersion(version string) string {
+	if w.Timestamp {
+		t, _ := time.ParseInLocation("20060102150405", version, time.Local)
+		return t.Add(time.Second).Format("20060102150405")
+	}
+	n, _ := strconv.ParseInt(version, 10, 64)
+	return fmt.Sprintf("%04d", n+1)
+}
+
+// nextVersion 递增序号取目录中已有迁移的最大版本号 + 1
+func (w MigrationWriter) nextVersion() (string, error) {
+	if w.Timestamp {
+		return time.Now().Format("20060102150405"), nil
+	}
+
+	var max int64
+	if gfile.Exists(w.Dir) {
+		files, err := gfile.ScanDir(w.Dir, "*.sql")
+		if err != nil {
+			return "", err
+		}
+		for _, path := range files {
+			matches := migrationFileRegex.FindStringSubmatch(gfile.Basename(path))
+			if matches == nil {
+				continue
+			}
+			if version, _ := strconv.ParseInt(matches[1], 10, 64); version > max {
+				max = version
+			}
+		}
+	}
+	return fmt.Sprintf("%04d", max+1), nil
+}
@@ -0,0 +1,89 @@
+package tablesync
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/glennliao/table-sync/model"
+	"github.com/gogf/gf/v2/os/gfile"
+)
+
+// 序号取目录中已有迁移的最大版本号 + 1, down 文件为逆序的还原SQL
+func TestMigrationWriter(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"0007_init.up.sql", "0007_init.down.sql", "0100_notes.sql", "seed.sql"} {
+		if err := gfile.PutContents(filepath.Join(dir, name), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plan, err := Diff(model.Schema{}, codeSchema(t, diffUserV1{}), "mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := MigrationWriter{Dir: dir}.Write(plan, "Add User!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Version != "0008" || file.UpPath != filepath.Join(dir, "0008_add_user.up.sql") || file.DownPath != filepath.Join(dir, "0008_add_user.down.sql") {
+		t.Errorf("got %+v", file)
+	}
+	up, down := gfile.GetContents(file.UpPath), gfile.GetContents(file.DownPath)
+	if !strings.HasPrefix(up, "-- Add User!\n-- database: mysql\n") || !strings.Contains(up, "CREATE TABLE `user`") {
+		t.Errorf("up file:\n%s", up)
+	}
+	if !strings.Contains(down, "DROP TABLE `user`") {
+		t.Errorf("down file:\n%s", down)
+	}
+
+	if file, err = (MigrationWriter{Dir: dir}).Write(&Plan{DatabaseType: "mysql"}, "nothing"); err != nil || file != nil {
+		t.Errorf("empty plan should not write files, got %+v %v", file, err)
+	}
+	if _, err = (MigrationWriter{Dir: dir}).Write(plan, "!!!"); err == nil {
+		t.Error("empty description should fail")
+	}
+
+	file, err = MigrationWriter{Dir: dir, Timestamp: true}.Write(plan, "add user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Version) != len("20060102150405") || !strings.HasSuffix(file.UpPath, file.Version+"_add_user.up.sql") {
+		t.Errorf("timestamp version: got %+v", file)
+	}
+}
+
+// 事务外执行的操作写入紧随其后的单独版本
+func TestMigrationWriterNoTx(t *testing.T) {
+	dir := t.TempDir()
+	addColumn := model.SyncSql{Table: "post", Kind: model.KindAddColumn, Name: "user_id",
+		Sql: []string{`ALTER TABLE "post" ADD COLUMN "user_id" int8`}, Down: []string{`ALTER TABLE "post" DROP COLUMN "user_id"`}}
+	addIndex := model.SyncSql{Table: "post", Kind: model.KindAddIndex, Name: "idx_user", NoTx: true,
+		Sql: []string{`CREATE INDEX CONCURRENTLY "idx_user" ON "post" (user_id)`}, Down: []string{`DROP INDEX IF EXISTS "idx_user"`}}
+
+	file, err := MigrationWriter{Dir: dir}.Write(&Plan{DatabaseType: "pgsql", Sql: []model.SyncSql{addColumn, addIndex}}, "post user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.NoTx == nil || file.NoTx.Version != "0002" || file.NoTx.UpPath != filepath.Join(dir, "0002_post_user_no_tx.up.sql") {
+		t.Fatalf("no tx file should follow version 0001, got %+v", file.NoTx)
+	}
+	if up := gfile.GetContents(file.UpPath); strings.Contains(up, "CONCURRENTLY") || !strings.Contains(up, "ADD COLUMN") {
+		t.Errorf("transactional file:\n%s", up)
+	}
+	if up := gfile.GetContents(file.NoTx.UpPath); !strings.Contains(up, "CONCURRENTLY") || strings.Contains(up, "ADD COLUMN") {
+		t.Errorf("no tx file:\n%s", up)
+	}
+	if down := gfile.GetContents(file.NoTx.DownPath); !strings.Contains(down, `DROP INDEX IF EXISTS "idx_user"`) {
+		t.Errorf("no tx down file:\n%s", down)
+	}
+
+	// 只有事务外的操作时只写一个版本
+	file, err = MigrationWriter{Dir: dir}.Write(&Plan{DatabaseType: "pgsql", Sql: []model.SyncSql{addIndex}}, "user index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.NoTx != nil || file.UpPath != filepath.Join(dir, "0003_user_index_no_tx.up.sql") {
+		t.Errorf("got %+v", file)
+	}
+}
@@ -0,0 +1,164 @@
+package tablesync
+
+import (
+	"context"
+	"strings"
+
+	"github.com/glennliao/table-sync/database"
+	"github.com/glennliao/table-sync/model"
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/errors/gerror"
+)
+
+// Plan 同步计划, 包含结构差异及各操作对应的SQL
+type Plan struct {
+	DatabaseType string
+	Task         model.SyncTask
+	Sql          []model.SyncSql
+}
+
+// Plan 计算代码与数据库之间的结构差异, 仅生成SQL不执行
+func (s *Syncer) Plan(ctx context.Context, db gdb.DB) (*Plan, error) {
+	if err := s.init(db); err != nil {
+		return nil, err
+	}
+
+	schemaInCode, err := s.schemaInCode(s.Tables)
+	if err != nil {
+		return nil, err
+	}
+	schemaInDB, err := LoadSchema(ctx, db, codeSchemas(schemaInCode)...)
+	if err != nil {
+		return nil, gerror.Cause(err)
+	}
+	return s.plan(ctx, db, schemaInDB, schemaInCode)
+}
+
+// Diff 离线比较两个表结构, 生成将 from 变更为 to 的计划, 不需要数据库连接,
+// 用于 CI 中比较上次发布的快照与当前代码, 会生成删除列/索引的 SQL
+func Diff(from, to model.Schema, dialect string) (*Plan, error) {
+	syncer := &Syncer{AllowDropColumn: true, AllowDropIndex: true}
+	return syncer.Diff(from, to, dialect)
+}
+
+// Diff 同 Diff, 删除列/索引按 Syncer 的配置
+func (s *Syncer) Diff(from, to model.Schema, dialect string) (*Plan, error) {
+	syncer := *s
+	syncer.DatabaseType, syncer.DatabaseDriver = dialect, database.RegMap[dialect]
+	if syncer.DatabaseDriver == nil {
+		return nil, gerror.Newf("unsupported database type: %s", dialect)
+	}
+	return syncer.plan(context.Background(), nil, from, to)
+}
+
+// plan db 为 nil 时离线生成, 驱动生成SQL时不能访问数据库
+func (s *Syncer) plan(ctx context.Context, db gdb.DB, schemaInDB, schemaInCode model.Schema) (*Plan, error) {
+	syncTask := s.compareSchema(schemaInCode, schemaInDB)
+	syncTask.SchemaInCode = schemaInCode
+	syncTask.SchemaInDB = schemaInDB
+	syncTask.ConcurrentIndex = s.ConcurrentIndex
+
+	sqlList, err := s.DatabaseDriver.GetSyncSql(ctx, db, syncTask)
+	if err != nil {
+		return nil, err
+	}
+	labelSafety(sqlList, classify(syncTask))
+
+	return &Plan{
+		DatabaseType: s.DatabaseType,
+		Task:         syncTask,
+		Sql:          sqlList,
+	}, nil
+}
+
+// Empty 是否无需变更
+func (p *Plan) Empty() bool {
+	return len(p.SqlList()) == 0
+}
+
+// SqlList 按执行顺序返回全部SQL
+func (p *Plan) SqlList() []string {
+	var list []string
+	for _, item := range p.Sql {
+		list = append(list, item.Sql...)
+	}
+	return list
+}
+
+// splitTx 事务中执行的SQL, 以及事务提交后执行的操作(NoTx)
+func (p *Plan) splitTx() (txList []string, noTxList []model.SyncSql) {
+	for _, item := range p.Sql {
+		if item.NoTx {
+			noTxList = append(noTxList, item)
+			continue
+		}
+		txList = append(txList, item.Sql...)
+	}
+	return
+}
+
+// splitDownTx 按撤销顺序返回事务中执行的 Down, 以及需在事务外执行的操作(Sql 为其 Down)
+func (p *Plan) splitDownTx() (txList []string, noTxList []model.SyncSql) {
+	for i := len(p.Sql) - 1; i >= 0; i-- {
+		item := p.Sql[i]
+		if item.NoTx {
+			noTxList = append(noTxList, model.SyncSql{Table: item.Table, Kind: item.Kind, Name: item.Name, Sql: item.Down, NoTx: true, Cleanup: item.Cleanup})
+			continue
+		}
+		txList = append(txList, item.Down...)
+	}
+	return
+}
+
+// ByTable 按表名分组
+func (p *Plan) ByTable() map[string][]model.SyncSql {
+	var m = map[string][]model.SyncSql{}
+	for _, item := range p.Sql {
+		m[item.Table] = append(m[item.Table], item)
+	}
+	return m
+}
+
+// DownSqlList 按撤销顺序返回全部SQL, 即逆序执行各操作的 Down
+func (p *Plan) DownSqlList() []string {
+	var list []string
+	for i := len(p.Sql) - 1; i >= 0; i-- {
+		list = append(list, p.Sql[i].Down...)
+	}
+	return list
+}
+
+func (p *Plan) String() string {
+	return p.format(false)
+}
+
+// DownString 按撤销顺序输出, 用于生成回滚脚本
+func (p *Plan) DownString() string {
+	return p.format(true)
+}
+
+func (p *Plan) format(down bool) string {
+	var b strings.Builder
+	for i := range p.Sql {
+		item, sqlList := p.Sql[i], p.Sql[i].Sql
+		if down {
+			item = p.Sql[len(p.Sql)-1-i]
+			sqlList = item.Down
+		}
+		b.WriteString("-- [" + item.Kind + "] " + item.Table)
+		if item.Name != "" {
+			b.WriteString("." + item.Name)
+		}
+		if !down && item.Safety != "" && item.Safety != model.SafetySafe {
+			b.WriteString(" (" + item.Safety + ": " + item.Reason + ")")
+		}
+		if !down && item.NoTx {
+			b.WriteString(" (outside transaction)")
+		}
+		b.WriteString("\n")
+		for _, sql := range sqlList {
+			b.WriteString(strings.TrimSuffix(strings.TrimSpace(sql), ";") + ";\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,126 @@
+package tablesync
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/glennliao/table-sync/model"
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/errors/gerror"
+)
+
+// preflightCheck 执行前对已有数据的检查, sql 返回不满足条件的行数
+type preflightCheck struct {
+	target string
+	sql    string
+	reason string
+}
+
+// preflight 按已有数据检查有风险的变更: 设置非空前的 NULL 值, 缩短长度前的超长值,
+// 唯一索引前的重复值, 整数类型缩小前的超范围值. 任一检查失败时返回报告, 不执行任何SQL
+func (s *Syncer) preflight(ctx context.Context, db gdb.DB, plan *Plan) error {
+	var failed []string
+	for _, check := range s.preflightChecks(db, plan.Task) {
+		count, err := db.GetValue(ctx, check.sql)
+		if err != nil {
+			return gerror.Wrapf(err, "preflight %s", check.target)
+		}
+		if n := count.Int64(); n > 0 {
+			failed = append(failed, fmt.Sprintf("  %s: %d %s", check.target, n, check.reason))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return gerror.Newf("preflight checks failed, nothing is executed:\n%s", strings.Join(failed, "\n"))
+}
+
+func (s *Syncer) preflightChecks(db gdb.DB, task model.SyncTask) (checks []preflightCheck) {
+	// 表名可能为 schema.table
+	quote, quoteTable := db.GetCore().QuoteWord, db.GetCore().QuoteString
+
+	for _, column := range task.AlterColumn {
+		dbTable := task.DBTable(column.TableName)
+		dbColumn, exists := task.DBColumn(column.TableName, task.DBColumnName(column.TableName, column.Field))
+		if dbTable == nil || !exists {
+			continue
+		}
+		target := column.TableName + "." + column.Field
+		from := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE ", quoteTable(dbTable.Name))
+		field := quote(dbColumn.Field)
+
+		if dbColumn.NotNull != "not null" && column.NotNull == "not null" {
+			checks = append(checks, preflightCheck{target, from + field + " IS NULL", "null values, set not null fails"})
+		}
+		if strings.EqualFold(dbColumn.Type, column.Type) || typeWidened(dbColumn.Type, column.Type) {
+			continue
+		}
+
+		fromName, _, _ := parseSqlType(dbColumn.Type)
+		toName, toSize, toUnsigned := parseSqlType(column.Type)
+		switch typeRank[toName].family {
+		case "string":
+			if len(toSize) == 0 {
+				continue
+			}
+			length := "LENGTH(CAST(" + field + " AS TEXT))"
+			if s.DatabaseType == "mysql" {
+				length = "CHAR_LENGTH(" + field + ")"
+			}
+			checks = append(checks, preflightCheck{target, fmt.Sprintf("%s%s > %d", from, length, toSize[0]),
+				fmt.Sprintf("values longer than %d", toSize[0])})
+		case "int":
+			// 仅检查数值类型的原列, 字符串转整数的合法性由数据库校验
+			if family := typeRank[fromName].family; family != "int" && family != "float" && fromName != "decimal" && fromName != "numeric" {
+				continue
+			}
+			min, max := intRange(typeRank[toName].rank, toUnsigned)
+			cond := fmt.Sprintf("%s < %d", field, min)
+			if max > 0 {
+				cond += fmt.Sprintf(" OR %s > %d", field, max)
+			}
+			checks = append(checks, preflightCheck{target, from + cond, fmt.Sprintf("values out of %s range", column.Type)})
+		}
+	}
+
+	for _, index := range task.AddIndex {
+		dbTable := task.DBTable(index.TableName)
+		if !index.Unique || dbTable == nil {
+			continue
+		}
+		// 新增列上的唯一索引无法预先检查
+		var fields, conds []string
+		for _, field := range index.Columns {
+			dbColumn, exists := task.DBColumn(index.TableName, task.DBColumnName(index.TableName, field))
+			if !exists {
+				fields = nil
+				break
+			}
+			fields = append(fields, quote(dbColumn.Field))
+			conds = append(conds, quote(dbColumn.Field)+" IS NOT NULL")
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		sql := fmt.Sprintf("SELECT COUNT(*) FROM (SELECT 1 AS n FROM %s WHERE %s GROUP BY %s HAVING COUNT(*) > 1) t",
+			quoteTable(dbTable.Name), strings.Join(conds, " AND "), strings.Join(fields, ","))
+		checks = append(checks, preflightCheck{index.TableName + "." + index.Name, sql, "duplicate values, unique index fails"})
+	}
+	return
+}
+
+// intRange 整数类型的取值范围, rank 见 typeRank, max 为0时不检查上限(bigint unsigned)
+func intRange(rank int, unsigned bool) (min int64, max uint64) {
+	bits := map[int]int{1: 8, 2: 16, 3: 24, 4: 32, 5: 64}[rank]
+	switch {
+	case bits == 64 && unsigned:
+		return 0, 0
+	case bits == 64:
+		return math.MinInt64, math.MaxInt64
+	case unsigned:
+		return 0, 1<<bits - 1
+	}
+	return -1 << (bits - 1), 1<<(bits-1) - 1
+}
@@ -0,0 +1,69 @@
+package tablesync
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type preflightUserV1 struct {
+	TableMeta `tableName:"user"`
+	Id        int64  `ddl:"primaryKey"`
+	Nick      string `ddl:"size:16"`
+	Email     string `ddl:"size:64"`
+	Level     int64
+}
+
+type preflightUserV2 struct {
+	TableMeta `tableName:"user"`
+	Id        int64  `ddl:"primaryKey"`
+	Nick      string `ddl:"size:3;not null"`
+	Email     string `ddl:"size:64;uniqueIndex"`
+	Level     int64  `ddl:"type:smallint"`
+}
+
+// 已有数据不满足变更时报告全部问题且不执行, 修正数据后同步成功
+func TestPreflight(t *testing.T) {
+	ctx := context.Background()
+	db := sqliteDB(t)
+	mustSync(t, db, &Syncer{Tables: []Table{preflightUserV1{}}})
+	for _, sql := range []string{
+		"INSERT INTO user (id, nick, email, level) VALUES (1, 'alice', 'a@x.com', 1)",
+		"INSERT INTO user (id, nick, email, level) VALUES (2, NULL, 'a@x.com', 70000)",
+		"INSERT INTO user (id, nick, email, level) VALUES (3, 'bob', NULL, 2)",
+		"INSERT INTO user (id, nick, email, level) VALUES (4, 'eve', NULL, 3)",
+	} {
+		if _, err := db.Exec(ctx, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	syncer := &Syncer{Tables: []Table{preflightUserV2{}}, AllowDestructive: true, Preflight: true}
+	err := syncer.Sync(ctx, db)
+	if err == nil {
+		t.Fatal("preflight should fail")
+	}
+	for _, want := range []string{
+		"user.nick: 1 null values",
+		"user.nick: 1 values longer than 3",
+		"user.level: 1 values out of smallint range",
+		"user.uk_email: 1 duplicate values",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("report should contain %q, got:\n%v", want, err)
+		}
+	}
+	if indexes, _ := db.GetAll(ctx, "PRAGMA index_list('user')"); len(indexes) != 0 {
+		t.Errorf("nothing should be executed after preflight fails, got indexes %v", indexes)
+	}
+
+	for _, sql := range []string{
+		"UPDATE user SET nick = 'ali' WHERE id = 1",
+		"UPDATE user SET nick = 'tom', email = 'b@x.com', level = 7 WHERE id = 2",
+	} {
+		if _, err = db.Exec(ctx, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustSync(t, db, syncer)
+}
@@ -0,0 +1,22 @@
+package tablesync
+
+import "sync"
+
+var (
+	registryMu sync.RWMutex
+	registry   []Table
+)
+
+// Register 注册需要同步的表, 供命令行工具等无法直接传入 Syncer.Tables 的场景使用
+func Register(tables ...Table) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, tables...)
+}
+
+// Registered 返回已注册的表
+func Registered() []Table {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return append([]Table(nil), registry...)
+}
@@ -0,0 +1,279 @@
+package tablesync
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/glennliao/table-sync/database"
+	"github.com/glennliao/table-sync/model"
+	"github.com/gogf/gf/v2/errors/gerror"
+)
+
+// change 结构差异中的单项变更及其影响分级
+type change struct {
+	table  string
+	kind   string
+	name   string
+	safety string
+	reason string
+}
+
+var safetyLevel = map[string]int{
+	model.SafetySafe:        0,
+	model.SafetyBlocking:    1,
+	model.SafetyDestructive: 2,
+}
+
+// classify 按结构差异对每项变更分级
+func classify(task model.SyncTask) (changes []change) {
+	add := func(table, kind, name, safety, reason string) {
+		changes = append(changes, change{table: table, kind: kind, name: name, safety: safety, reason: reason})
+	}
+
+	for _, rename := range task.RenameTable {
+		add(rename.To, model.KindRenameTable, "", model.SafetyBlocking, "rename table "+rename.From+", clients using the old name fail")
+	}
+	for _, table := range task.CreateTable {
+		add(table.Name, model.KindCreateTable, "", model.SafetySafe, "")
+	}
+	for _, alter := range task.AlterTable {
+		safety, reason := model.SafetySafe, ""
+		if alter.Charset {
+			safety, reason = convertCharsetSafety(task.DBTable(alter.Table.Name), alter.Table)
+		}
+		if alter.PrimaryKey && safety == model.SafetySafe {
+			safety, reason = model.SafetyBlocking, "change primary key, rebuilds table and fails on duplicate values"
+		}
+		add(alter.Table.Name, model.KindAlterTable, "", safety, reason)
+	}
+	for _, rename := range task.RenameColumn {
+		add(rename.TableName, model.KindRenameColumn, rename.Column.Field, model.SafetyBlocking, "rename column "+rename.From+", clients using the old name fail")
+	}
+	for _, column := range task.AddColumn {
+		if column.NotNull == "not null" && column.Default == "" && !column.PrimaryKey {
+			add(column.TableName, model.KindAddColumn, column.Field, model.SafetyBlocking, "not null without default, fails or fills zero values on existing rows")
+		} else {
+			add(column.TableName, model.KindAddColumn, column.Field, model.SafetySafe, "")
+		}
+	}
+	for _, column := range task.AlterColumn {
+		dbColumn, _ := task.DBColumn(column.TableName, task.DBColumnName(column.TableName, column.Field))
+		safety, reason := alterColumnSafety(dbColumn, column)
+		add(column.TableName, model.KindAlterColumn, column.Field, safety, reason)
+	}
+	for _, column := range task.DropColumn {
+		add(column.TableName, model.KindDropColumn, column.Field, model.SafetyDestructive, "drop column and its data")
+	}
+	for _, index := range task.DropIndex {
+		add(index.TableName, model.KindDropIndex, index.Name, model.SafetySafe, "")
+	}
+	for _, index := range task.AddIndex {
+		reason := "build index on existing rows"
+		if index.Unique {
+			reason = "build unique index, fails on duplicate values"
+		}
+		add(index.TableName, model.KindAddIndex, index.Name, model.SafetyBlocking, reason)
+	}
+	for _, fk := range task.DropForeignKey {
+		add(fk.TableName, model.KindDropForeignKey, fk.Name, model.SafetySafe, "")
+	}
+	for _, fk := range task.AddForeignKey {
+		add(fk.TableName, model.KindAddForeignKey, fk.Name, model.SafetyBlocking, "validate existing rows, fails on orphan values")
+	}
+	for _, check := range task.DropCheck {
+		add(check.TableName, model.KindDropCheck, check.Name, model.SafetySafe, "")
+	}
+	for _, check := range task.AddCheck {
+		add(check.TableName, model.KindAddCheck, check.Name, model.SafetyBlocking, "validate existing rows, fails on violating values")
+	}
+	return
+}
+
+// alterColumnSafety 设置非空及缩小类型可能丢失数据, 扩大类型仅需重写表
+func alterColumnSafety(dbColumn, codeColumn model.Column) (safety string, reason string) {
+	var reasons []string
+	safety = model.SafetySafe
+	raise := func(s string, r string) {
+		if safetyLevel[s] > safetyLevel[safety] {
+			safety = s
+		}
+		reasons = append(reasons, r)
+	}
+
+	if !strings.EqualFold(dbColumn.Type, codeColumn.Type) {
+		if typeWidened(dbColumn.Type, codeColumn.Type) {
+			raise(model.SafetyBlocking, fmt.Sprintf("widen type %s to %s", dbColumn.Type, codeColumn.Type))
+		} else {
+			raise(model.SafetyDestructive, fmt.Sprintf("change type %s to %s, existing values may be truncated or fail to convert", dbColumn.Type, codeColumn.Type))
+		}
+	}
+	if dbColumn.NotNull != "not null" && codeColumn.NotNull == "not null" {
+		raise(model.SafetyDestructive, "set not null, existing null values fail or are replaced")
+	}
+	return safety, strings.Join(reasons, "; ")
+}
+
+// 同类类型按可存储范围排序, 从低到高转换不丢失数据
+var typeRank = map[string]struct {
+	family string
+	rank   int
+}{
+	"tinyint": {"int", 1}, "smallint": {"int", 2}, "int2": {"int", 2}, "mediumint": {"int", 3},
+	"int": {"int", 4}, "integer": {"int", 4}, "int4": {"int", 4}, "bigint": {"int", 5}, "int8": {"int", 5},
+
+	"float": {"float", 1}, "real": {"float", 1}, "float4": {"float", 1},
+	"double": {"float", 2}, "double precision": {"float", 2}, "float8": {"float", 2},
+
+	"char": {"string", 1}, "character": {"string", 1}, "varchar": {"string", 2}, "character varying": {"string", 2},
+	"tinytext": {"string", 3}, "text": {"string", 4}, "mediumtext": {"string", 5}, "longtext": {"string", 6},
+
+	"tinyblob": {"blob", 1}, "blob": {"blob", 2}, "mediumblob": {"blob", 3}, "longblob": {"blob", 4},
+}
+
+// typeWidened 类型是否仅扩大了可存储范围, eg: varchar(64) -> varchar(256), int -> bigint
+func typeWidened(from, to string) bool {
+	fromName, fromSize, fromUnsigned := parseSqlType(from)
+	toName, toSize, toUnsigned := parseSqlType(to)
+
+	fromRank, toRank := typeRank[fromName], typeRank[toName]
+	if fromName != toName {
+		if fromRank.family == "" || fromRank.family != toRank.family || fromRank.rank > toRank.rank {
+			return false
+		}
+	}
+	// 有符号转无符号丢失负数, 无符号转有符号需更大的类型
+	if fromUnsigned != toUnsigned && (toUnsigned || fromName == toName || fromRank.rank >= toRank.rank) {
+		return false
+	}
+	// 长度/精度均不小于原类型, 无长度的类型(text)不受限制
+	if len(toSize) > 0 && len(fromSize) > 0 {
+		if len(toSize) != len(fromSize) {
+			return false
+		}
+		for i := range toSize {
+			if toSize[i] < fromSize[i] {
+				return false
+			}
+		}
+	}
+	if len(toSize) > 0 && len(fromSize) == 0 && toRank.family == "string" {
+		return false
+	}
+	return true
+}
+
+// parseSqlType eg: decimal(10,2) unsigned -> decimal, [10 2], true
+func parseSqlType(sqlType string) (name string, size []int, unsigned bool) {
+	name = strings.ToLower(strings.TrimSpace(sqlType))
+	if i := strings.Index(name, "("); i > 0 {
+		if j := strings.Index(name[i:], ")"); j > 0 {
+			for _, s := range strings.Split(name[i+1:i+j], ",") {
+				n, _ := strconv.Atoi(strings.TrimSpace(s))
+				size = append(size, n)
+			}
+			name = name[:i] + name[i+j+1:]
+		}
+	}
+	name = strings.Join(strings.Fields(name), " ")
+	if strings.HasSuffix(name, " unsigned") {
+		name, unsigned = strings.TrimSuffix(name, " unsigned"), true
+	}
+	return
+}
+
+// labelSafety 按变更分级标记SQL, 重建表(sqlite)取该表各变更中的最高级别
+func labelSafety(list []model.SyncSql, changes []change) {
+	for i := range list {
+		item := &list[i]
+		item.Safety, item.Reason = model.SafetySafe, ""
+		rebuild := item.Kind == model.KindRebuildTable
+
+		var reasons []string
+		for _, c := range changes {
+			if c.table != item.Table {
+				continue
+			}
+			if rebuild && !rebuildKinds[c.kind] || !rebuild && (c.kind != item.Kind || c.name != item.Name) {
+				continue
+			}
+			if safetyLevel[c.safety] > safetyLevel[item.Safety] {
+				item.Safety = c.safety
+			}
+			if c.reason != "" && rebuild && c.name != "" {
+				reasons = append(reasons, c.name+": "+c.reason)
+			} else if c.reason != "" {
+				reasons = append(reasons, c.reason)
+			}
+		}
+		if rebuild && item.Safety == model.SafetySafe {
+			item.Safety = model.SafetyBlocking
+			reasons = append(reasons, "rebuild table")
+		}
+		item.Reason = strings.Join(reasons, "; ")
+	}
+}
+
+// rebuildKinds 重建表包含的变更
+var rebuildKinds = map[string]bool{
+	model.KindAlterTable:     true,
+	model.KindAlterColumn:    true,
+	model.KindDropColumn:     true,
+	model.KindRenameColumn:   true,
+	model.KindAddForeignKey:  true,
+	model.KindDropForeignKey: true,
+	model.KindAddCheck:       true,
+	model.KindDropCheck:      true,
+}
+
+// checkSafety 存在未允许的破坏性变更时返回错误, 列出全部相关的表/列;
+// 已通过 AllowDropColumn 允许的删除列不再拦截
+func (s *Syncer) checkSafety(plan *Plan) error {
+	if s.AllowDestructive {
+		return nil
+	}
+	var refused []string
+	for _, c := range classify(plan.Task) {
+		if c.safety != model.SafetyDestructive || c.kind == model.KindDropColumn && s.AllowDropColumn {
+			continue
+		}
+		target := c.table
+		if c.name != "" {
+			target += "." + c.name
+		}
+		refused = append(refused, fmt.Sprintf("  [%s] %s: %s", c.kind, target, c.reason))
+	}
+	if len(refused) == 0 {
+		return nil
+	}
+	return gerror.Newf("destructive changes refused, set Syncer.AllowDestructive to apply:\n%s", strings.Join(refused, "\n"))
+}
+
+// unicodeCharsets 可表示全部 Unicode 字符的字符集
+var unicodeCharsets = map[string]bool{"utf8mb4": true, "utf16": true, "utf16le": true, "utf32": true}
+
+// convertCharsetSafety 目标字符集无法表示原字符集的全部字符时, 转换会将这些字符替换为 ?
+func convertCharsetSafety(dbTable *model.Table, table model.Table) (string, string) {
+	to := database.Charset(table.Charset, table.Collation)
+	if dbTable == nil {
+		return model.SafetyBlocking, "convert charset, rebuilds table"
+	}
+	from := database.Charset(dbTable.Charset, dbTable.Collation)
+	if !charsetContains(to, from) {
+		return model.SafetyDestructive, fmt.Sprintf("convert charset %s to %s, characters not in %s are lost", from, to, to)
+	}
+	return model.SafetyBlocking, "convert charset, rebuilds table"
+}
+
+// charsetContains to 是否可表示 from 的全部字符
+func charsetContains(to string, from string) bool {
+	switch {
+	case to == from || unicodeCharsets[to]:
+		return true
+	case to == "utf8mb3" || to == "ucs2":
+		return from == "utf8mb3" || from == "ucs2" || from == "latin1" || from == "ascii"
+	case to == "latin1":
+		return from == "ascii"
+	}
+	return false
+}
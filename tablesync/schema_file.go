@@ -0,0 +1,97 @@
+package tablesync
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/gogf/gf/v2/encoding/gyaml"
+	"github.com/gogf/gf/v2/errors/gerror"
+	"github.com/gogf/gf/v2/os/gfile"
+)
+
+// SchemaFile 声明式表结构文件(YAML/JSON), 与结构体定义等价:
+//
+//	tables:
+//	  - name: user
+//	    comment: 用户
+//	    checks: ["length(name) > 0"]
+//	    columns:
+//	      - name: id
+//	        type: int64
+//	        ddl: primaryKey
+//	      - name: name
+//	        type: string
+//	        ddl: size:64;not null;uniqueIndex;comment:用户名
+type SchemaFile struct {
+	Tables []TableFile `json:"tables" yaml:"tables"`
+}
+
+// TableFile 表定义, 对应结构体的 TableMeta 标签
+type TableFile struct {
+	Name          string       `json:"name" yaml:"name"`
+	Schema        string       `json:"schema,omitempty" yaml:"schema,omitempty"` // pgsql schema
+	Group         string       `json:"group,omitempty" yaml:"group,omitempty"`   // SyncAll 时同步到的数据库分组
+	Comment       string       `json:"comment,omitempty" yaml:"comment,omitempty"`
+	Charset       string       `json:"charset,omitempty" yaml:"charset,omitempty"`
+	Collate       string       `json:"collate,omitempty" yaml:"collate,omitempty"`
+	PreviousNames []string     `json:"previousNames,omitempty" yaml:"previousNames,omitempty"`
+	Checks        []string     `json:"checks,omitempty" yaml:"checks,omitempty"`
+	OnlineDDL     string       `json:"onlineDDL,omitempty" yaml:"onlineDDL,omitempty"` // mysql 在线变更策略 auto/require
+	Columns       []ColumnFile `json:"columns" yaml:"columns"`
+}
+
+// ColumnFile 列定义, Type 为 go 类型(也可在 DDL 中用 type: 指定数据库类型), DDL 与结构体的 ddl 标签相同
+type ColumnFile struct {
+	Name string `json:"name" yaml:"name"`
+	Type string `json:"type" yaml:"type"`
+	DDL  string `json:"ddl,omitempty" yaml:"ddl,omitempty"`
+}
+
+// loadSchemaFile 按扩展名(.yaml/.yml 或 .json)解析结构文件
+func loadSchemaFile(path string) ([]tableDef, error) {
+	data := gfile.GetBytes(path)
+	if data == nil {
+		return nil, gerror.Newf("read schema file %s failed", path)
+	}
+
+	var file SchemaFile
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = gyaml.DecodeTo(data, &file)
+	default:
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, gerror.Wrapf(err, "decode schema file %s", path)
+	}
+
+	var defs []tableDef
+	for _, table := range file.Tables {
+		if table.Name == "" {
+			return nil, gerror.Newf("schema file %s: table name is required", path)
+		}
+		def := tableDef{
+			Name: table.Name,
+			Meta: map[string]string{
+				"comment":       table.Comment,
+				"charset":       table.Charset,
+				"collate":       table.Collate,
+				"previousNames": strings.Join(table.PreviousNames, ","),
+				"checks":        strings.Join(table.Checks, ";"),
+				"onlineDDL":     table.OnlineDDL,
+				"schema":        table.Schema,
+				"group":         table.Group,
+			},
+		}
+		for _, column := range table.Columns {
+			if column.Name == "" || column.Type == "" {
+				return nil, gerror.Newf("schema file %s: table %s column name and type are required", path, table.Name)
+			}
+			def.Fields = append(def.Fields, fieldDef{Column: column.Name, Type: column.Type, DDL: column.DDL})
+		}
+		defs = append(defs, def)
+	}
+	return defs, nil
+}
@@ -0,0 +1,90 @@
+package tablesync
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gogf/gf/v2/os/gfile"
+)
+
+type fileUser struct {
+	TableMeta `tableName:"user" comment:"用户" previousNames:"member" checks:"length(name) > 0"`
+	Id        int64  `ddl:"primaryKey"`
+	Name      string `ddl:"size:64;not null;uniqueIndex;comment:用户名"`
+	Score     int    `ddl:"default:0"`
+}
+
+const fileUserYAML = `tables:
+  - name: user
+    comment: 用户
+    previousNames: [member]
+    checks: ["length(name) > 0"]
+    columns:
+      - name: id
+        type: int64
+        ddl: primaryKey
+      - name: name
+        type: string
+        ddl: size:64;not null;uniqueIndex;comment:用户名
+      - name: score
+        type: int
+        ddl: default:0
+`
+
+const fileUserJSON = `{"tables": [{
+  "name": "user", "comment": "用户", "previousNames": ["member"], "checks": ["length(name) > 0"],
+  "columns": [
+    {"name": "id", "type": "int64", "ddl": "primaryKey"},
+    {"name": "name", "type": "string", "ddl": "size:64;not null;uniqueIndex;comment:用户名"},
+    {"name": "score", "type": "int", "ddl": "default:0"}
+  ]
+}]}`
+
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := gfile.PutContents(path, content); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// 结构文件与相同定义的结构体生成一致的表结构
+func TestSchemaFile(t *testing.T) {
+	want, err := (&Syncer{Tables: []Table{fileUser{}}}).CodeSnapshot("mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJSON, _ := want.JSON()
+
+	for _, path := range []string{writeFile(t, "user.yaml", fileUserYAML), writeFile(t, "user.json", fileUserJSON)} {
+		got, err := (&Syncer{SchemaFiles: []string{path}}).CodeSnapshot("mysql")
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if gotJSON, _ := got.JSON(); !bytes.Equal(gotJSON, wantJSON) {
+			t.Errorf("%s:\n%s\nwant:\n%s", filepath.Base(path), gotJSON, wantJSON)
+		}
+	}
+}
+
+func TestSchemaFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		syncer  *Syncer
+		message string
+	}{
+		{"missing file", &Syncer{SchemaFiles: []string{filepath.Join(t.TempDir(), "missing.yaml")}}, "read schema file"},
+		{"invalid json", &Syncer{SchemaFiles: []string{writeFile(t, "bad.json", "{")}}, "decode schema file"},
+		{"table name", &Syncer{SchemaFiles: []string{writeFile(t, "a.yaml", "tables:\n  - columns: []\n")}}, "table name is required"},
+		{"column type", &Syncer{SchemaFiles: []string{writeFile(t, "b.yaml", "tables:\n  - name: t\n    columns:\n      - name: id\n")}}, "column name and type are required"},
+		{"duplicate", &Syncer{Tables: []Table{fileUser{}}, SchemaFiles: []string{writeFile(t, "user.yaml", fileUserYAML)}}, "already defined"},
+	}
+	for _, tt := range tests {
+		_, err := tt.syncer.CodeSnapshot("mysql")
+		if err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("%s: want error containing %q, got %v", tt.name, tt.message, err)
+		}
+	}
+}
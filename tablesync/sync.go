@@ -2,7 +2,10 @@ package tablesync
 
 import (
 	"context"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/glennliao/table-sync/database"
 	_ "github.com/glennliao/table-sync/database/mysql"
@@ -22,19 +25,99 @@ type Syncer struct {
 	Tables         []Table
 	DatabaseType   string
 	DatabaseDriver database.Database
+
+	// SchemaFiles 声明式表结构文件(YAML/JSON), 与 Tables 一起同步, 格式见 SchemaFile
+	SchemaFiles []string
+	// DefaultSchema pgsql 中未通过 TableMeta schema 标签指定 schema 的表所在的 schema, 默认 public,
+	// schema 标签及该配置在其余数据库中忽略
+	DefaultSchema string
+
+	// AllowDropColumn 删除数据库中存在但代码中已不存在的列, 默认仅输出警告
+	AllowDropColumn bool
+	// AllowDropIndex 删除数据库中存在但代码中已不存在的索引
+	AllowDropIndex bool
+	// AllowDestructive 执行可能丢失数据的变更(缩小列类型/设置非空等), 默认拒绝同步并返回相关的列
+	AllowDestructive bool
+	// Preflight 执行前查询已有数据, 存在 NULL 值/超长值/重复值/超范围值导致变更失败时中止并返回报告
+	Preflight bool
+	// ConcurrentIndex pgsql 在已有表上使用 CREATE INDEX CONCURRENTLY 创建新索引, 不阻塞写入,
+	// 在其余变更的事务提交后执行, 失败时删除未完成的索引
+	ConcurrentIndex bool
+
+	// RecordHistory 将每次执行的同步/回滚记录到 tablesync_history 表
+	RecordHistory bool
+	// AppVersion 记录到同步历史中的应用版本
+	AppVersion string
+
+	// LockTimeout 大于0时, 同步前获取跨实例的锁, 多个实例同时启动时仅一个执行变更,
+	// 其余实例等待后重新比较结构, 超时返回错误
+	LockTimeout time.Duration
+
+	// Group 仅同步 TableMeta group 标签(结构文件中的 group)为该数据库分组的表, 默认 default,
+	// 需与传入的 db 对应; SyncAll 按分组分别设置
+	Group string
 }
 
-func (s *Syncer) Sync(ctx context.Context, db gdb.DB) error {
+// LockName 同步锁名称
+const LockName = "tablesync"
+
+func (s *Syncer) init(db gdb.DB) (err error) {
 	s.DatabaseType = db.GetConfig().Type
-	s.DatabaseDriver = database.RegMap[s.DatabaseType]
-	schemaInCode := s.schemaInCode(s.Tables)
-	schemaInDB, err := s.DatabaseDriver.LoadSchema(ctx, db)
+	s.DatabaseDriver, err = Driver(db)
+	return
+}
+
+// Driver 返回 db 对应的数据库驱动
+func Driver(db gdb.DB) (database.Database, error) {
+	driver := database.RegMap[db.GetConfig().Type]
+	if driver == nil {
+		return nil, gerror.Newf("unsupported database type: %s", db.GetConfig().Type)
+	}
+	return driver, nil
+}
+
+// LoadSchema 读取数据库结构, schemas 为 pgsql 中读取的 schema, 为空时仅读取 public
+func LoadSchema(ctx context.Context, db gdb.DB, schemas ...string) (model.Schema, error) {
+	driver, err := Driver(db)
 	if err != nil {
-		return gerror.Cause(err)
+		return model.Schema{}, err
+	}
+	if loader, ok := driver.(database.SchemaLoader); ok && len(schemas) > 0 {
+		return loader.LoadSchemas(ctx, db, schemas)
+	}
+	return driver.LoadSchema(ctx, db)
+}
+
+// codeSchemas 代码中的表(及重命名前的表)所在的 schema
+func codeSchemas(schema model.Schema) []string {
+	var names = map[string]struct{}{model.PublicSchema: {}}
+	for _, table := range schema.Tables {
+		for _, name := range append([]string{table.Name}, table.PreviousNames...) {
+			if name, _ := model.SplitQualifiedName(name); name != "" {
+				names[name] = struct{}{}
+			}
+		}
+	}
+	var list []string
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func (s *Syncer) Sync(ctx context.Context, db gdb.DB) error {
+	unlock, err := s.lock(ctx, db)
+	if err != nil {
+		return err
 	}
-	syncTask := s.compareSchema(schemaInCode, schemaInDB)
-	syncTask.SchemaInCode = schemaInCode
-	return s.sync(ctx, db, syncTask)
+	defer unlock()
+
+	plan, err := s.Plan(ctx, db)
+	if err != nil {
+		return err
+	}
+	return s.sync(ctx, db, plan)
 }
 
 func (s *Syncer) compareSchema(codeSchema model.Schema, dbSchema model.Schema) (task model.SyncTask) {
@@ -42,11 +125,25 @@ func (s *Syncer) compareSchema(codeSchema model.Schema, dbSchema model.Schema) (
 		dbTable := dbSchema.Tables[tableName]
 
 		if dbTable == nil {
-			task.CreateTable = append(task.CreateTable, *codeTable)
-			continue
+			from := previousTableName(*codeTable, codeSchema, dbSchema)
+			if from == "" {
+				task.CreateTable = append(task.CreateTable, *codeTable)
+				continue
+			}
+
+			task.RenameTable = append(task.RenameTable, model.TableRename{From: from, To: tableName})
+			dbTable = dbSchema.Tables[from]
 		}
 
-		// todo table comment
+		// 表注释/字符集/主键, 数据库未返回字符集时(sqlite/pgsql)不比较字符集
+		tableAlter := model.TableAlter{Table: *codeTable}
+		tableAlter.Comment = !dbSchema.NoComment && unescapeQuote(codeTable.Comment) != unescapeQuote(dbTable.Comment)
+		tableAlter.Charset = dbTable.Charset != "" && charsetChanged(*codeTable, *dbTable)
+		// 代码中未声明主键时保留数据库中的主键
+		tableAlter.PrimaryKey = len(codeTable.PrimaryKey) > 0 && !ListEq(codeTable.PrimaryKey, dbTable.PrimaryKey)
+		if tableAlter.Comment || tableAlter.Charset || tableAlter.PrimaryKey {
+			task.AlterTable = append(task.AlterTable, tableAlter)
+		}
 
 		var dbColumnMap = map[string]model.Column{}
 		for _, column := range dbTable.Columns {
@@ -57,18 +154,26 @@ func (s *Syncer) compareSchema(codeSchema model.Schema, dbSchema model.Schema) (
 			codeCol.TableName = tableName
 
 			if _, exists := dbColumnMap[codeCol.Field]; !exists {
+				from := codeCol.DDLTag[model.DDLWas]
+				if dbCol, renamed := dbColumnMap[from]; renamed && !hasColumn(*codeTable, from) {
+					task.RenameColumn = append(task.RenameColumn, model.ColumnRename{
+						TableName: tableName,
+						From:      from,
+						Column:    codeCol,
+					})
+					if columnChanged(codeCol, dbCol, dbSchema.NoComment) {
+						task.AlterColumn = append(task.AlterColumn, codeCol)
+					}
+					continue
+				}
+
 				task.AddColumn = append(task.AddColumn, codeCol)
 				continue
 			}
 
 			dbCol := dbColumnMap[codeCol.Field]
 
-			typeDiff := dbCol.Type != codeCol.Type && strings.ToLower(dbCol.Type) != codeCol.Type
-			commentDiff := !dbSchema.NoComment && strings.Trim(strings.ReplaceAll(codeCol.Comment, "\\'", "'"), "") != strings.Trim(dbCol.Comment, "")
-			notNullDiff := dbCol.NotNull != codeCol.NotNull
-			defaultDiff := dbCol.Default != strings.Trim(codeCol.Default, "'")
-
-			if typeDiff || commentDiff || notNullDiff || defaultDiff {
+			if columnChanged(codeCol, dbCol, dbSchema.NoComment) {
 				// g.Log().Debug(nil, "code", codeCol)
 				// g.Log().Debug(nil, "db", dbCol)
 
@@ -76,47 +181,325 @@ func (s *Syncer) compareSchema(codeSchema model.Schema, dbSchema model.Schema) (
 			}
 		}
 
+		for _, dbCol := range abandonColumns(*codeTable, *dbTable) {
+			if s.AllowDropColumn {
+				task.DropColumn = append(task.DropColumn, dbCol)
+			} else {
+				g.Log().Warningf(context.Background(), "[tablesync] Table [%s] Find Abandon Field: %s", tableName, dbCol.Field)
+			}
+		}
+
 		// index
 		var dbIndexMap = map[string]model.Index{}
 		for _, index := range dbTable.Index {
 			dbIndexMap[index.Name] = index
 		}
 
+		var codeIndexMap = map[string]struct{}{}
 		for _, codeIndex := range codeTable.Index {
-			if _, exists := dbIndexMap[codeIndex.Name]; !exists {
-				codeIndex.TableName = tableName
+			codeIndex.TableName = tableName
+			codeIndexMap[codeIndex.Name] = struct{}{}
+
+			dbIndex, exists := dbIndexMap[codeIndex.Name]
+			if !exists {
+				task.AddIndex = append(task.AddIndex, codeIndex)
+				continue
+			}
+
+			// 列/顺序/唯一性变更或创建失败, 删除后重建
+			if dbIndex.Invalid || dbIndex.Unique != codeIndex.Unique || !ListEq(dbIndex.Columns, codeIndex.Columns) {
+				dbIndex.TableName = tableName
+				task.DropIndex = append(task.DropIndex, dbIndex)
 				task.AddIndex = append(task.AddIndex, codeIndex)
 			}
 		}
+
+		// foreign key
+		var dbForeignKeyMap = map[string]model.ForeignKey{}
+		for _, fk := range dbTable.ForeignKeys {
+			dbForeignKeyMap[fk.Name] = fk
+			// mysql 为外键自动创建的同名索引
+			codeIndexMap[fk.Name] = struct{}{}
+		}
+
+		for _, codeFk := range codeTable.ForeignKeys {
+			codeFk.TableName = tableName
+			dbFk, exists := dbForeignKeyMap[codeFk.Name]
+			if !exists {
+				task.AddForeignKey = append(task.AddForeignKey, codeFk)
+				continue
+			}
+			if foreignKeyChanged(codeFk, dbFk) {
+				dbFk.TableName = tableName
+				task.DropForeignKey = append(task.DropForeignKey, dbFk)
+				task.AddForeignKey = append(task.AddForeignKey, codeFk)
+			}
+		}
+
+		// check
+		var dbCheckMap = map[string]model.Check{}
+		for _, check := range dbTable.Checks {
+			dbCheckMap[check.Name] = check
+		}
+
+		for _, codeCheck := range codeTable.Checks {
+			codeCheck.TableName = tableName
+			dbCheck, exists := dbCheckMap[codeCheck.Name]
+			if !exists {
+				task.AddCheck = append(task.AddCheck, codeCheck)
+				continue
+			}
+			if normalizeCheckExpr(codeCheck.Expr) != normalizeCheckExpr(dbCheck.Expr) {
+				dbCheck.TableName = tableName
+				task.DropCheck = append(task.DropCheck, dbCheck)
+				task.AddCheck = append(task.AddCheck, codeCheck)
+			}
+		}
+
+		if s.AllowDropIndex {
+			for _, dbIndex := range dbTable.Index {
+				if _, exists := codeIndexMap[dbIndex.Name]; !exists {
+					dbIndex.TableName = tableName
+					task.DropIndex = append(task.DropIndex, dbIndex)
+				}
+			}
+		}
 	}
 	return
 }
 
-func (s *Syncer) sync(ctx context.Context, db gdb.DB, task model.SyncTask) error {
+// charsetChanged 仅比较代码中声明的字符集/排序规则, 未声明时保留数据库中的设置
+func charsetChanged(codeTable model.Table, dbTable model.Table) bool {
+	if codeTable.Charset == "" && codeTable.Collation == "" {
+		return false
+	}
+	if database.Charset(codeTable.Charset, codeTable.Collation) != database.Charset(dbTable.Charset, dbTable.Collation) {
+		return true
+	}
+	return codeTable.Collation != "" && database.NormalizeCharset(codeTable.Collation) != database.NormalizeCharset(dbTable.Collation)
+}
 
-	sqlList, err := database.RegMap[s.DatabaseType].GetSyncSql(ctx, db, task)
+// previousTableName 数据库中以旧名称存在的表, 且旧名称未被代码中的其他表使用
+func previousTableName(codeTable model.Table, codeSchema model.Schema, dbSchema model.Schema) string {
+	for _, name := range codeTable.PreviousNames {
+		if _, exists := codeSchema.Tables[name]; exists {
+			continue
+		}
+		if _, exists := dbSchema.Tables[name]; exists {
+			return name
+		}
+	}
+	return ""
+}
+
+// foreignKeyChanged mysql 中 RESTRICT 与 NO ACTION 等价, 不视为变更
+func foreignKeyChanged(codeFk model.ForeignKey, dbFk model.ForeignKey) bool {
+	action := func(s string) string {
+		s = strings.ToUpper(s)
+		if s == "" || s == "RESTRICT" {
+			return "NO ACTION"
+		}
+		return s
+	}
+	return codeFk.RefTable != dbFk.RefTable ||
+		!ListEq(codeFk.Columns, dbFk.Columns) ||
+		!ListEq(codeFk.RefColumns, dbFk.RefColumns) ||
+		action(codeFk.OnDelete) != action(dbFk.OnDelete) ||
+		action(codeFk.OnUpdate) != action(dbFk.OnUpdate)
+}
+
+var (
+	checkCharsetRegex = regexp.MustCompile(`_[a-z0-9]+'`)
+	checkCastRegex    = regexp.MustCompile(`::[a-z_]+( varying| precision| without time zone| with time zone)?(\[\])?`)
+	checkBetweenRegex = regexp.MustCompile(`([\w."` + "`" + `]+)\s+between\s+(\S+)\s+and\s+(\S+)`)
+	checkAnyRegex     = regexp.MustCompile(`=anyarray\[([^\]]*)\]`)
+	checkAllRegex     = regexp.MustCompile(`<>allarray\[([^\]]*)\]`)
+)
+
+// normalizeCheckExpr 数据库会改写约束表达式, 比较前统一格式: 去除括号/引号/空白,
+// mysql 字符串前缀 _utf8mb4, pgsql 类型转换 ::text, 以及 pgsql 将 in (...) 改写为 = ANY (ARRAY[...]),
+// not in 改写为 <> ALL (ARRAY[...]), between 改写为 >= and <=
+func normalizeCheckExpr(expr string) string {
+	expr = checkCharsetRegex.ReplaceAllString(strings.ToLower(expr), "'")
+	expr = checkCastRegex.ReplaceAllString(expr, "")
+	expr = checkBetweenRegex.ReplaceAllString(expr, "$1 >= $2 and $1 <= $3")
+	expr = strings.ReplaceAll(expr, "!=", "<>")
+	expr = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\n', '(', ')', '`', '"':
+			return -1
+		}
+		return r
+	}, expr)
+	expr = checkAnyRegex.ReplaceAllString(expr, "in$1")
+	return checkAllRegex.ReplaceAllString(expr, "notin$1")
+}
+
+func columnChanged(codeCol model.Column, dbCol model.Column, noComment bool) bool {
+	typeDiff := dbCol.Type != codeCol.Type && strings.ToLower(dbCol.Type) != codeCol.Type
+	commentDiff := !noComment && unescapeQuote(codeCol.Comment) != unescapeQuote(dbCol.Comment)
+	notNullDiff := dbCol.NotNull != codeCol.NotNull
+	// 数据库返回的默认值不带引号, 离线比较两个代码中的结构时两边都可能带引号
+	defaultDiff := strings.Trim(dbCol.Default, "'") != strings.Trim(codeCol.Default, "'")
+
+	return typeDiff || commentDiff || notNullDiff || defaultDiff
+}
+
+// unescapeQuote 代码中的注释单引号已转义为 \', 数据库中为 '
+func unescapeQuote(s string) string {
+	return strings.ReplaceAll(s, "\\'", "'")
+}
+
+func hasColumn(table model.Table, field string) bool {
+	for _, column := range table.Columns {
+		if column.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// abandonColumns 数据库中存在但代码中已不存在的列, 重命名前的列不计入
+func abandonColumns(codeTable model.Table, dbTable model.Table) (list []model.Column) {
+	var codeColumnMap = map[string]struct{}{}
+	for _, column := range codeTable.Columns {
+		codeColumnMap[column.Field] = struct{}{}
+		if from := column.DDLTag[model.DDLWas]; from != "" && !hasColumn(codeTable, from) {
+			codeColumnMap[from] = struct{}{}
+		}
+	}
+
+	for _, column := range dbTable.Columns {
+		if _, exists := codeColumnMap[column.Field]; !exists {
+			column.TableName = codeTable.Name
+			list = append(list, column)
+		}
+	}
+	return
+}
+
+// Rollback 撤销已执行的同步计划, 按逆序执行各操作的 Down
+// 删除列/表的数据无法恢复, 仅还原结构
+func (s *Syncer) Rollback(ctx context.Context, db gdb.DB, plan *Plan) error {
+	unlock, err := s.lock(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err = s.init(db); err != nil {
+		return err
+	}
+
+	// 与同步相反, 先撤销事务提交后执行的操作, 再在事务中撤销其余操作
+	txList, noTxList := plan.splitDownTx()
+	err = s.execNoTx(ctx, db, noTxList)
+	if err == nil {
+		err = s.exec(ctx, db, txList)
+	}
+	return s.record(ctx, db, plan, HistoryActionRollback, err)
+}
+
+// lock 未设置 LockTimeout 时不加锁
+func (s *Syncer) lock(ctx context.Context, db gdb.DB) (unlock func(), err error) {
+	if s.LockTimeout <= 0 {
+		return func() {}, nil
+	}
+	if err = s.init(db); err != nil {
+		return nil, err
+	}
+
+	release, err := s.DatabaseDriver.Lock(ctx, db, LockName, s.LockTimeout)
 	if err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := release(ctx); err != nil {
+			g.Log().Warning(ctx, "[tablesync] release lock:", err)
+		}
+	}, nil
+}
+
+func (s *Syncer) sync(ctx context.Context, db gdb.DB, plan *Plan) error {
+	if err := s.checkSafety(plan); err != nil {
 		return err
 	}
-	if len(sqlList) > 0 {
-		return db.Transaction(ctx, func(ctx context.Context, tx gdb.TX) error {
-			var err error
-			for _, sql := range sqlList {
-				g.Log().Info(ctx, "[tablesync]", sql)
-				_, err = db.Exec(ctx, sql)
-				if err != nil {
-					g.Log().Warning(ctx, err)
-					g.Log().Info(ctx, "[tablesync] break ")
-					break
+	if s.Preflight {
+		if err := s.preflight(ctx, db, plan); err != nil {
+			return err
+		}
+	}
+	txList, noTxList := plan.splitTx()
+	err := s.exec(ctx, db, txList)
+	if err == nil {
+		err = s.execNoTx(ctx, db, noTxList)
+	}
+	return s.record(ctx, db, plan, HistoryActionSync, err)
+}
+
+// record 未执行任何SQL时不记录历史, 记录失败不覆盖同步本身的错误
+func (s *Syncer) record(ctx context.Context, db gdb.DB, plan *Plan, action string, syncErr error) error {
+	if !s.RecordHistory || plan.Empty() {
+		return syncErr
+	}
+
+	statements := plan.String()
+	if action == HistoryActionRollback {
+		statements = plan.DownString()
+	}
+
+	if err := s.recordHistory(ctx, db, plan, action, statements, syncErr); err != nil {
+		if syncErr != nil {
+			g.Log().Warning(ctx, "[tablesync] record history:", err)
+			return syncErr
+		}
+		return err
+	}
+	return syncErr
+}
+
+// execNoTx 依次执行不能在事务中执行的操作, 此时事务中的变更已提交,
+// 失败时执行该操作的 Cleanup 清理未完成的变更
+func (s *Syncer) execNoTx(ctx context.Context, db gdb.DB, list []model.SyncSql) error {
+	for _, item := range list {
+		for _, sql := range item.Sql {
+			g.Log().Info(ctx, "[tablesync]", sql)
+			if _, err := db.Exec(ctx, sql); err != nil {
+				g.Log().Warning(ctx, err)
+				for _, cleanup := range item.Cleanup {
+					g.Log().Info(ctx, "[tablesync] cleanup", cleanup)
+					if _, e := db.Exec(ctx, cleanup); e != nil {
+						g.Log().Warning(ctx, "[tablesync] cleanup:", e)
+					}
 				}
+				return gerror.Cause(err)
 			}
-			if err == nil {
-				g.Log().Info(ctx, "[tablesync] finish ")
-			}
-			return gerror.Cause(err)
-		})
+		}
 	}
-
 	return nil
+}
+
+func (s *Syncer) exec(ctx context.Context, db gdb.DB, sqlList []string) error {
+	if len(sqlList) == 0 {
+		return nil
+	}
+	if executor, ok := s.DatabaseDriver.(database.TxExecutor); ok {
+		return executor.ExecTx(ctx, db, sqlList)
+	}
 
+	return db.Transaction(ctx, func(ctx context.Context, tx gdb.TX) error {
+		var err error
+		for _, sql := range sqlList {
+			g.Log().Info(ctx, "[tablesync]", sql)
+			_, err = db.Exec(ctx, sql)
+			if err != nil {
+				g.Log().Warning(ctx, err)
+				g.Log().Info(ctx, "[tablesync] break ")
+				break
+			}
+		}
+		if err == nil {
+			g.Log().Info(ctx, "[tablesync] finish ")
+		}
+		return gerror.Cause(err)
+	})
 }
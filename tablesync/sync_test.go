@@ -0,0 +1,278 @@
+package tablesync
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glennliao/table-sync/model"
+	_ "github.com/gogf/gf/contrib/drivers/sqlite/v2"
+	"github.com/gogf/gf/v2/database/gdb"
+)
+
+// sqliteDB 临时目录中的 sqlite 数据库, 开启外键约束
+func sqliteDB(t *testing.T) gdb.DB {
+	db, err := gdb.New(gdb.ConfigNode{
+		Type:  "sqlite",
+		Name:  filepath.Join(t.TempDir(), "test.db"),
+		Extra: "foreign_keys=1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close(context.Background()) })
+	return db
+}
+
+func mustSync(t *testing.T, db gdb.DB, syncer *Syncer) {
+	t.Helper()
+	if err := syncer.Sync(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := syncer.Plan(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Empty() {
+		t.Fatalf("plan should be empty after sync, got:\n%s", plan)
+	}
+}
+
+type fkParentV1 struct {
+	TableMeta `tableName:"parent"`
+	Id        int64  `ddl:"primaryKey"`
+	Name      string `ddl:"size:32"`
+}
+
+type fkParentV2 struct {
+	TableMeta `tableName:"parent"`
+	Id        int64  `ddl:"primaryKey"`
+	Name      string `ddl:"size:64"`
+}
+
+type fkChild struct {
+	TableMeta `tableName:"child"`
+	Id        int64 `ddl:"primaryKey"`
+	ParentId  int64 `ddl:"fk:parent.id;onDelete:cascade"`
+}
+
+// 重建被引用的表时不能触发子表的 ON DELETE CASCADE
+func TestSyncRebuildReferencedTable(t *testing.T) {
+	ctx := context.Background()
+	db := sqliteDB(t)
+
+	mustSync(t, db, &Syncer{Tables: []Table{fkParentV1{}, fkChild{}}})
+	if _, err := db.Exec(ctx, "INSERT INTO parent (id, name) VALUES (1, 'a')"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(ctx, "INSERT INTO child (id, parent_id) VALUES (1, 1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	mustSync(t, db, &Syncer{Tables: []Table{fkParentV2{}, fkChild{}}})
+
+	count, err := db.GetCount(ctx, "SELECT COUNT(*) FROM child")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("child rows after rebuilding parent: got %d, want 1", count)
+	}
+	enabled, err := db.GetValue(ctx, "PRAGMA foreign_keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !enabled.Bool() {
+		t.Error("foreign_keys should be restored after sync")
+	}
+}
+
+// 外键检查失败时回滚, 不留下部分变更
+func TestSyncForeignKeyCheck(t *testing.T) {
+	ctx := context.Background()
+	db := sqliteDB(t)
+
+	mustSync(t, db, &Syncer{Tables: []Table{fkParentV1{}}})
+	if _, err := db.Exec(ctx, "CREATE TABLE child (id INTEGER PRIMARY KEY, parent_id INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(ctx, "INSERT INTO child (id, parent_id) VALUES (1, 2)"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := (&Syncer{Tables: []Table{fkParentV1{}, fkChild{}}, AllowDestructive: true}).Sync(ctx, db)
+	if err == nil {
+		t.Fatal("sync should fail on orphan child rows")
+	}
+	fks, err := db.GetAll(ctx, "PRAGMA foreign_key_list('child')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fks) != 0 {
+		t.Errorf("foreign key should not be added after failed check, got %v", fks)
+	}
+}
+
+// 数据库保存的约束表达式(pg_get_constraintdef / information_schema.check_clause)与代码中的写法等价
+func TestNormalizeCheckExpr(t *testing.T) {
+	tests := []struct {
+		code, stored string
+	}{
+		{"state in (0,1,2)", "((state = ANY (ARRAY[0, 1, 2])))"},
+		{"state in (0,1,2)", "(`state` in (0,1,2))"},
+		{"state not in (3, 4)", "((state <> ALL (ARRAY[3, 4])))"},
+		{"kind in ('a','b')", "((kind)::text = ANY ((ARRAY['a'::character varying, 'b'::character varying])::text[]))"},
+		{"kind in ('a','b')", "(`kind` in (_utf8mb4'a',_utf8mb4'b'))"},
+		{"length(name) > 0", "((length((name)::text) > 0))"},
+		{"price between 0 and 100", "(((price >= 0) AND (price <= 100)))"},
+		{"qty != 0", "((qty <> 0))"},
+	}
+	for _, tt := range tests {
+		if code, stored := normalizeCheckExpr(tt.code), normalizeCheckExpr(tt.stored); code != stored {
+			t.Errorf("%s: %s != %s", tt.stored, code, stored)
+		}
+	}
+	if normalizeCheckExpr("state in (0,1)") == normalizeCheckExpr("((state = ANY (ARRAY[0, 1, 2])))") {
+		t.Error("changed expression should differ")
+	}
+}
+
+type checkOrder struct {
+	TableMeta `tableName:"orders" checks:"price between 0 and 100"`
+	Id        int64 `ddl:"primaryKey"`
+	State     int   `ddl:"check:state in (0,1,2)"`
+	Price     int
+}
+
+// pgsql 读回的约束表达式与代码一致时, 第二次同步无变更
+func TestCheckRoundTrip(t *testing.T) {
+	snapshot, err := (&Syncer{Tables: []Table{checkOrder{}}}).CodeSnapshot("pgsql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := snapshot.Schema()
+
+	stored := map[string]string{
+		"chk_orders_state": "((state = ANY (ARRAY[0, 1, 2])))",
+		"chk_orders_1":     "(((price >= 0) AND (price <= 100)))",
+	}
+	table := *code.Tables["orders"]
+	table.Checks = nil
+	for _, check := range code.Tables["orders"].Checks {
+		if stored[check.Name] == "" {
+			t.Fatalf("unexpected check %s", check.Name)
+		}
+		check.Expr = stored[check.Name]
+		table.Checks = append(table.Checks, check)
+	}
+	db := model.Schema{Tables: map[string]*model.Table{"orders": &table}}
+
+	plan, err := Diff(db, code, "pgsql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Empty() {
+		t.Errorf("second plan should be empty, got:\n%s", plan)
+	}
+
+	mustSync(t, sqliteDB(t), &Syncer{Tables: []Table{checkOrder{}}})
+}
+
+type postV1 struct {
+	TableMeta `tableName:"post"`
+	Id        int64  `ddl:"primaryKey"`
+	State     string `ddl:"size:16;not null;default:'draft'"`
+	Title     string `ddl:"size:32"`
+}
+
+type postV2 struct {
+	TableMeta `tableName:"post"`
+	Id        int64  `ddl:"primaryKey"`
+	Title     string `ddl:"size:64"`
+}
+
+// 回滚后结构与同步前一致, 删除的列恢复默认值
+func TestRollback(t *testing.T) {
+	ctx := context.Background()
+	db := sqliteDB(t)
+	mustSync(t, db, &Syncer{Tables: []Table{postV1{}}})
+
+	syncer := &Syncer{Tables: []Table{postV2{}}, AllowDropColumn: true, AllowDestructive: true}
+	plan, err := syncer.Plan(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustSync(t, db, syncer)
+	if err = syncer.Rollback(ctx, db, plan); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err = (&Syncer{Tables: []Table{postV1{}}}).Plan(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Empty() {
+		t.Errorf("plan should be empty after rollback, got:\n%s", plan)
+	}
+	if _, err = db.Exec(ctx, "INSERT INTO post (id, title) VALUES (1, 'a')"); err != nil {
+		t.Fatal(err)
+	}
+	state, err := db.GetValue(ctx, "SELECT state FROM post WHERE id = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.String() != "draft" {
+		t.Errorf("restored column default: got %q, want draft", state.String())
+	}
+}
+
+// 其他实例持有锁时等待超时, 不执行任何变更
+func TestSyncLock(t *testing.T) {
+	ctx := context.Background()
+	db := sqliteDB(t)
+	syncer := &Syncer{Tables: []Table{fkParentV1{}}, LockTimeout: 200 * time.Millisecond}
+	if err := syncer.init(db); err != nil {
+		t.Fatal(err)
+	}
+	release, err := syncer.DatabaseDriver.Lock(ctx, db, LockName, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = syncer.Sync(ctx, db); err == nil {
+		t.Fatal("sync should time out while another instance holds the lock")
+	}
+	if tables, _ := db.Tables(ctx); strings.Contains(strings.Join(tables, ","), "parent") {
+		t.Errorf("nothing should be created while locked, got %v", tables)
+	}
+
+	if err = release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mustSync(t, db, syncer)
+}
+
+// 回滚时事务外的操作逆序先执行且不在事务中(sqlite 的 VACUUM 不能在事务中执行)
+func TestRollbackNoTx(t *testing.T) {
+	ctx := context.Background()
+	db := sqliteDB(t)
+	plan := &Plan{DatabaseType: "sqlite", Sql: []model.SyncSql{
+		{Table: "tag", Kind: model.KindCreateTable, Sql: []string{"CREATE TABLE tag (id INTEGER PRIMARY KEY, name varchar(32))"}, Down: []string{"DROP TABLE tag"}},
+		{Table: "tag", Kind: model.KindAddIndex, Name: "idx_name", NoTx: true,
+			Sql: []string{"CREATE INDEX tag_idx_name ON tag (name)"}, Down: []string{"DROP INDEX tag_idx_name", "VACUUM"}},
+	}}
+	for _, sql := range plan.SqlList() {
+		if _, err := db.Exec(ctx, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := (&Syncer{}).Rollback(ctx, db, plan); err != nil {
+		t.Fatal(err)
+	}
+	if tables, _ := db.Tables(ctx); strings.Contains(strings.Join(tables, ","), "tag") {
+		t.Errorf("table should be dropped after rollback, got %v", tables)
+	}
+}